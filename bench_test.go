@@ -0,0 +1,168 @@
+package trie
+
+import (
+	"strconv"
+	"testing"
+)
+
+// deepPrefixRoutes returns routes sharing long static prefixes.
+func deepPrefixRoutes() []string {
+	var routes []string
+	for _, resource := range []string{"projects", "tasks", "files", "teams", "users"} {
+		prefix := "/api/v1/organizations/:org/resources/" + resource
+		routes = append(routes, prefix, prefix+"/:id", prefix+"/:id/activities/latest")
+		for i := 0; i < 10; i++ {
+			routes = append(routes, prefix+"/:id/settings/section"+strconv.Itoa(i))
+		}
+	}
+	return routes
+}
+
+func BenchmarkTrieMatchDeepPrefix(b *testing.B) {
+	tr := New()
+	for _, route := range deepPrefixRoutes() {
+		tr.Define(route)
+	}
+	paths := []string{
+		"/api/v1/organizations/teambition/resources/projects",
+		"/api/v1/organizations/teambition/resources/tasks/123/activities/latest",
+		"/api/v1/organizations/teambition/resources/users/123/settings/section9",
+		"/api/v1/organizations/teambition/resources/files/123/settings/none",
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			tr.Match(path)
+		}
+	}
+	b.ReportMetric(float64(tr.Stats().NodeCount), "nodes")
+}
+
+// staticRoutes returns routes without any parameter.
+func staticRoutes() []string {
+	var routes []string
+	for _, resource := range []string{"projects", "tasks", "files", "teams", "users"} {
+		prefix := "/api/v1/resources/" + resource
+		routes = append(routes, prefix, prefix+"/", prefix+"/activities/latest")
+		for i := 0; i < 10; i++ {
+			routes = append(routes, prefix+"/settings/section"+strconv.Itoa(i))
+		}
+	}
+	return routes
+}
+
+func benchmarkStaticMatch(b *testing.B, tr *Trie) {
+	for _, route := range staticRoutes() {
+		tr.Define(route)
+	}
+	paths := []string{
+		"/api/v1/resources/projects",
+		"/api/v1/resources/tasks/activities/latest",
+		"/api/v1/resources/users/settings/section9",
+		"/api/v1/resources/files/settings/none",
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			tr.Match(path)
+		}
+	}
+}
+
+func BenchmarkTrieMatchStatic(b *testing.B) {
+	benchmarkStaticMatch(b, New())
+}
+
+// BenchmarkTrieMatchStaticGeneric defines an unrelated param route, so Match
+// takes the generic path on the same static route set.
+func BenchmarkTrieMatchStaticGeneric(b *testing.B) {
+	tr := New()
+	tr.Define("/other/:id")
+	benchmarkStaticMatch(b, tr)
+}
+
+func benchmarkMatchBytes(b *testing.B, match func(tr *Trie, path []byte)) {
+	tr := New()
+	for _, route := range deepPrefixRoutes() {
+		tr.Define(route)
+	}
+	for _, route := range staticRoutes() {
+		tr.Define(route)
+	}
+	paths := [][]byte{
+		[]byte("/api/v1/organizations/teambition/resources/tasks/123/activities/latest"),
+		[]byte("/api/v1/resources/tasks/activities/latest"),
+		[]byte("/api/v1/resources/users/settings/none"),
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			match(tr, path)
+		}
+	}
+}
+
+func BenchmarkTrieMatchString(b *testing.B) {
+	benchmarkMatchBytes(b, func(tr *Trie, path []byte) {
+		tr.Match(string(path))
+	})
+}
+
+func BenchmarkTrieMatchBytes(b *testing.B) {
+	benchmarkMatchBytes(b, func(tr *Trie, path []byte) {
+		tr.MatchBytes(path)
+	})
+}
+
+func benchmarkRegexSiblings(b *testing.B, optimize bool) {
+	tr := New()
+	for i := 0; i < 10; i++ {
+		tr.Define("/items/:id" + strconv.Itoa(i) + "(^" + strconv.Itoa(i) + "[a-z]+$)")
+	}
+	if optimize {
+		tr.Optimize()
+	}
+	paths := []string{"/items/0abc", "/items/5abc", "/items/9abc", "/items/xabc"}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			tr.Match(path)
+		}
+	}
+}
+
+func BenchmarkTrieMatchRegexSiblings(b *testing.B) {
+	benchmarkRegexSiblings(b, false)
+}
+
+func BenchmarkTrieMatchRegexSiblingsOptimized(b *testing.B) {
+	benchmarkRegexSiblings(b, true)
+}
+
+func BenchmarkTrieMatchStaticChain(b *testing.B) {
+	tr := New()
+	for i := 0; i < 10; i++ {
+		tr.Define("/api/v1/admin/reports/monthly/exports/report" + strconv.Itoa(i))
+	}
+	paths := []string{
+		"/api/v1/admin/reports/monthly/exports/report0",
+		"/api/v1/admin/reports/monthly/exports/report9",
+		"/api/v1/admin/reports/monthly/exports/none",
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			tr.Match(path)
+		}
+	}
+}
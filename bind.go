@@ -0,0 +1,83 @@
+package trie
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Bind populates the fields of the struct that v points to with the captured
+// params, the field tag "param" names the param of the field. A field without
+// the param uses the value of the tag "default" if it is set, otherwise it is
+// left unchanged. The supported field kinds are string, bool, integers and
+// floats. It returns an error wrapping ErrInvalidParam if a value can't be
+// converted to the kind of its field.
+//
+//  type params struct {
+//  	ID   int    `param:"id"`
+//  	Name string `param:"name" default:"guest"`
+//  }
+//  var p params
+//  err := trie.Match("/users/42").Bind(&p)
+//
+func (m *Matched) Bind(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Bind requires a non-nil pointer to a struct, got %T", v)
+	}
+
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		name, ok := field.Tag.Lookup("param")
+		if !ok || name == "" || field.PkgPath != "" {
+			continue
+		}
+		value, ok := m.Params[name]
+		if !ok {
+			if value, ok = field.Tag.Lookup("default"); !ok {
+				continue
+			}
+		}
+		if err := setField(rv.Field(i), value); err != nil {
+			return newError(ErrInvalidParam, `invalid param "%s" for field "%s": %v`, name, field.Name, err)
+		}
+	}
+	return nil
+}
+
+// setField converts the value to the kind of the field and sets it.
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported kind %s", field.Kind())
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package trie
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTrieMatchedBind(t *testing.T) {
+	assert := assert.New(t)
+
+	type params struct {
+		ID      int     `param:"id"`
+		Name    string  `param:"name"`
+		Page    uint8   `param:"page" default:"1"`
+		Ratio   float64 `param:"ratio"`
+		Draft   bool    `param:"draft"`
+		Ignored string
+		private int `param:"id"`
+	}
+
+	tr := New()
+	tr.Define("/users/:id/:name")
+	tr.Define("/pages/:id/:name/:page/:ratio/:draft")
+
+	var p params
+	assert.Nil(tr.Match("/users/42/tom").Bind(&p))
+	assert.Equal(42, p.ID)
+	assert.Equal("tom", p.Name)
+	assert.Equal(uint8(1), p.Page)
+	assert.Equal("", p.Ignored)
+	assert.Equal(0, p.private)
+
+	p = params{}
+	assert.Nil(tr.Match("/pages/-7/x/200/0.5/true").Bind(&p))
+	assert.Equal(params{ID: -7, Name: "x", Page: 200, Ratio: 0.5, Draft: true}, p)
+
+	err := tr.Match("/users/abc/tom").Bind(&p)
+	assert.True(errors.Is(err, ErrInvalidParam))
+	assert.Contains(err.Error(), `invalid param "id" for field "ID"`)
+	err = tr.Match("/pages/1/x/300/0.5/true").Bind(&p)
+	assert.True(errors.Is(err, ErrInvalidParam))
+
+	var bad struct {
+		Tags []string `param:"name"`
+	}
+	assert.NotNil(tr.Match("/users/1/tom").Bind(&bad))
+	assert.NotNil(tr.Match("/users/1/tom").Bind(p))
+	assert.NotNil(tr.Match("/users/1/tom").Bind((*params)(nil)))
+
+	// no captured params
+	p = params{}
+	assert.Nil(new(Matched).Bind(&p))
+	assert.Equal(uint8(1), p.Page)
+}
@@ -0,0 +1,58 @@
+package trie
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// MatchBytes matches the path like Match but without converting the path to a
+// string, it views the bytes as a string instead. The path is copied once only
+// if the result has captured values or redirect paths, or an OnMiss hook gets
+// the path, so they don't alias the path and the path can be reused after
+// MatchBytes returns. The OnMatch and OnMiss hooks run after the values are
+// copied. The remaining path passed to a Node.Delegate matcher is not copied,
+// it must not be retained.
+//
+//  matched := trie.MatchBytes([]byte("/a/b"))
+//
+func (t *Trie) MatchBytes(path []byte) *Matched {
+	view := *(*string)(unsafe.Pointer(&path))
+	matched := t.matchRoute(view, nil)
+	if len(matched.Params) == 0 && len(matched.Positional) == 0 && matched.FPR == "" && matched.TSR == "" {
+		if matched.Node == nil && len(t.onMiss) > 0 {
+			view = string(path)
+		}
+		t.runHooks(view, matched, nil)
+		return matched
+	}
+
+	owned := string(path)
+	for key, value := range matched.Params {
+		matched.Params[key] = rebaseString(view, owned, value)
+	}
+	for i, param := range matched.ordered {
+		matched.ordered[i].Value = rebaseString(view, owned, param.Value)
+	}
+	for i, value := range matched.Positional {
+		matched.Positional[i] = rebaseString(view, owned, value)
+	}
+	matched.FPR = rebaseString(view, owned, matched.FPR)
+	matched.TSR = rebaseString(view, owned, matched.TSR)
+	t.runHooks(owned, matched, nil)
+	return matched
+}
+
+// rebaseString returns the same substring of owned if s is a substring of view,
+// otherwise s itself.
+func rebaseString(view, owned, s string) string {
+	if s == "" {
+		return s
+	}
+	base := (*reflect.StringHeader)(unsafe.Pointer(&view)).Data
+	data := (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+	if data < base || data+uintptr(len(s)) > base+uintptr(len(view)) {
+		return s
+	}
+	offset := int(data - base)
+	return owned[offset : offset+len(s)]
+}
@@ -0,0 +1,75 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTrieMatchBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := New(Options{AnonymousParams: true, TrailingSlashRedirect: true})
+	node := tr.Define("/users/:user/repos/:")
+	tr.Define("/files/:path*")
+
+	path := []byte("/users/tom/repos/trie")
+	res := tr.MatchBytes(path)
+	EqualPtr(t, node, res.Node)
+	assert.Equal("tom", res.Params["user"])
+	assert.Equal([]string{"trie"}, res.Positional)
+
+	// the result doesn't alias the reused path
+	copy(path, "/users/bob/repos/xxxx")
+	assert.Equal("tom", res.Params["user"])
+	assert.Equal([]string{"trie"}, res.Positional)
+
+	path = []byte("/files/a/b/")
+	res = tr.MatchBytes(path)
+	assert.Equal("a/b/", res.Params["path"])
+	copy(path, "/files/x/y/")
+	assert.Equal("a/b/", res.Params["path"])
+
+	path = []byte("/users/tom/repos/trie/")
+	res = tr.MatchBytes(path)
+	assert.Nil(res.Node)
+	assert.Equal("/users/tom/repos/trie", res.TSR)
+	copy(path, "/users/bob/repos/xxxx/")
+	assert.Equal("/users/tom/repos/trie", res.TSR)
+
+	tr = New()
+	tr.Define("/a/b")
+	path = []byte("/a//b")
+	res = tr.MatchBytes(path)
+	assert.Equal("/a/b", res.FPR)
+	copy(path, "/x//y")
+	assert.Equal("/a/b", res.FPR)
+	assert.NotNil(tr.MatchBytes([]byte("/a/b")).Node)
+
+	assert.Nil(tr.MatchBytes([]byte("/x")).Node)
+	assert.Panics(func() {
+		tr.MatchBytes(nil)
+	})
+
+	// the hooks don't get values that alias the reused path
+	tr = New()
+	var missed, user string
+	tr.OnMiss(func(path string, depth int) {
+		missed = path
+	})
+	tr.Define("/users/:user").OnMatch(func(params map[string]string) {
+		user = params["user"]
+	})
+	path = []byte("/posts/1")
+	assert.Nil(tr.MatchBytes(path).Node)
+	copy(path, "/xxxxx/2")
+	assert.Equal("/posts/1", missed)
+	path = []byte("/users/tom")
+	assert.NotNil(tr.MatchBytes(path).Node)
+	copy(path, "/users/bob")
+	assert.Equal("tom", user)
+	path = []byte("/users/tom/x")
+	assert.Nil(tr.MatchBytes(path).Node)
+	copy(path, "/users/bob/y")
+	assert.Equal("/users/tom/x", missed)
+}
@@ -0,0 +1,88 @@
+package trie
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// staticChain compresses a chain of single static children below a node, such as
+// "v1/resources" below "/api" when "/api/v1/resources/:id" is the only route
+// under "/api", so Match skips the chain by comparing the path with the key once,
+// instead of looking up the nodes segment by segment.
+//
+// It only speeds up Match, the nodes are not merged into multi-segment nodes:
+// they are still defined per segment, as Define, Node.Define and
+// Matched.LastNode expose them, so the node count doesn't change and the chains
+// take some more memory. MatchTrace and the other probed matches don't use them.
+type staticChain struct {
+	// the keys of the chained nodes joined with "/"
+	key string
+	// the last node of the chain
+	end *Node
+	// the number of chained nodes
+	depth int
+}
+
+// skip returns the length of the key if the path starts with the whole key
+// followed by "/" or nothing, otherwise 0.
+func (c *staticChain) skip(path string) int {
+	if !strings.HasPrefix(path, c.key) || len(path) > len(c.key) && path[len(c.key)] != '/' {
+		return 0
+	}
+	return len(c.key)
+}
+
+// compressChains builds the static chains of the trie if it was modified since
+// they were built. It is called by Match, so the chains are split lazily when a
+// divergent route is defined. Modifications are not safe for concurrent use
+// with Match, but concurrent Match calls can build the chains.
+func (t *Trie) compressChains() {
+	if atomic.LoadInt32(&t.compressed) == 1 {
+		return
+	}
+	t.compressMu.Lock()
+	defer t.compressMu.Unlock()
+	if atomic.LoadInt32(&t.compressed) == 0 {
+		compressNode(t.root)
+		atomic.StoreInt32(&t.compressed, 1)
+	}
+}
+
+// compressNode builds the static chains of the node and its descendants.
+func compressNode(n *Node) {
+	n.chain = nil
+	var keys []string
+	var end *Node
+	for child := n.chainedChild(); child != nil; child = child.chainedChild() {
+		keys = append(keys, child.key)
+		end = child
+		// the delegate of a node is tried from its own position
+		if child.delegate != nil {
+			break
+		}
+	}
+	if len(keys) > 1 {
+		n.chain = &staticChain{key: strings.Join(keys, "/"), end: end, depth: len(keys)}
+	}
+
+	for _, child := range n.children {
+		compressNode(child)
+	}
+	for _, child := range n.varyChildren {
+		compressNode(child)
+	}
+}
+
+// chainedChild returns the only child of the node if it is static and always
+// matches its key, otherwise nil.
+func (n *Node) chainedChild() *Node {
+	if len(n.children) != 1 || len(n.varyChildren) > 0 {
+		return nil
+	}
+	for _, child := range n.children {
+		if child.key != "" && child.enabled == nil {
+			return child
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package trie
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTrieStaticChains(t *testing.T) {
+	t.Run("Match skips the chains with the same result", func(t *testing.T) {
+		patterns := []string{
+			"/api/v1/organizations/:org/resources/projects",
+			"/api/v1/organizations/:org/resources/projects/:id/settings/section1",
+			"/api/v1/organizations/:org/resources/projects/:id/settings/section2",
+			"/api/v1/organizations/:org/resources/tasks/:id/activities/latest",
+			"/deep/a/b/c",
+			"/deep/a/b/c/d/e/",
+			"/Mixed/Case/Path",
+			"/proxy/to/remote",
+		}
+		paths := []string{
+			"/api/v1/organizations/tb/resources/projects",
+			"/api/v1/organizations/tb/resources/projects/",
+			"/api/v1/organizations/tb/resources/projects/1/settings/section1",
+			"/api/v1/organizations/tb/resources/projects/1/settings/section3",
+			"/api/v1/organizations/tb/resources/tasks/1/activities/latest",
+			"/api/v1/organizations/tb/resources/tasks/1/activities",
+			"/api/v1/organizations", "/api/v1/organizations/", "/api/v2/organizations",
+			"/API/V1/organizations/tb/resources/projects",
+			"/deep/a/b/c", "/deep/a/b/c/", "/deep/a/b", "/deep/a/bc", "/deep/a/b/c/d/e",
+			"/deep/a/b/c/d/e/", "/deep//a/b/c", "/mixed/case/path", "/Mixed/Case/Path",
+			"/proxy/to/remote/x/y", "/proxy/to", "/",
+		}
+
+		for _, opts := range []Options{{}, defaultOptions, {TrailingSlashRedirect: true}} {
+			tr := New(opts)
+			for _, pattern := range patterns {
+				tr.Define(pattern)
+			}
+			tr.Define("/proxy/to/remote").Delegate(func(remaining string) *Matched {
+				return &Matched{Pattern: "delegated:" + remaining}
+			})
+
+			for _, path := range paths {
+				// MatchTrace matches segment by segment
+				expected, _ := tr.MatchTrace(path)
+				actual := tr.Match(path)
+				assert.Equal(t, expected.Node, actual.Node, path)
+				assert.Equal(t, expected.Pattern, actual.Pattern, path)
+				assert.Equal(t, expected.Params, actual.Params, path)
+				assert.Equal(t, expected.TSR, actual.TSR, path)
+				assert.Equal(t, expected.FPR, actual.FPR, path)
+				assert.Equal(t, expected.MatchedDepth, actual.MatchedDepth, path)
+				assert.Equal(t, expected.LastNode, actual.LastNode, path)
+			}
+		}
+	})
+
+	t.Run("Chains are split when a divergent route is defined", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/api/v1/resources/:id")
+		EqualPtr(t, node, tr.Match("/api/v1/resources/1").Node)
+		assert.Equal("api/v1/resources", tr.root.chain.key)
+		assert.Equal(3, tr.root.chain.depth)
+		EqualPtr(t, node.parent, tr.root.chain.end)
+
+		other := tr.Define("/api/v2")
+		EqualPtr(t, other, tr.Match("/api/v2").Node)
+		assert.Nil(tr.root.chain)
+		EqualPtr(t, node, tr.Match("/api/v1/resources/1").Node)
+		assert.Equal(4, tr.Match("/api/v1/resources/1").MatchedDepth)
+
+		// a static only trie uses the chains too
+		tr = New()
+		node = tr.Define("/a/b/c")
+		EqualPtr(t, node, tr.Match("/a/b/c").Node)
+		assert.Equal("a/b/c", tr.root.chain.key)
+		tr.RemoveSubtree("/a/b")
+		assert.Nil(tr.Match("/a/b/c").Node)
+		assert.Nil(tr.root.chain)
+
+		// a node with a predicate is not chained
+		tr = New()
+		tr.Define("/x/y/z").parent.SetEnabled(func() bool { return false })
+		assert.Nil(tr.Match("/x/y/z").Node)
+		assert.Nil(tr.root.chain)
+	})
+
+	t.Run("Freeze builds the chains", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/a/b/c")
+		tr.Freeze()
+		assert.Equal("a/b/c", tr.root.chain.key)
+	})
+
+	t.Run("Concurrent Match builds the chains once", func(t *testing.T) {
+		tr := New()
+		node := tr.Define("/api/v1/resources/:id")
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				EqualPtr(t, node, tr.Match("/api/v1/resources/1").Node)
+			}()
+		}
+		wg.Wait()
+	})
+}
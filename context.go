@@ -0,0 +1,22 @@
+package trie
+
+import "context"
+
+// MatchContext matches the path like Match, but it checks the context before
+// every segment and returns the error of the context if it is canceled or its
+// deadline is exceeded, then the partial result is discarded. A regexp evaluation
+// in progress is not interrupted. It matters for deep or regexp-heavy tries only,
+// as it is slower than Match.
+//
+//  ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+//  defer cancel()
+//  matched, err := trie.MatchContext(ctx, "/a/b")
+//
+func (t *Trie) MatchContext(ctx context.Context, path string) (*Matched, error) {
+	probe := &matchProbe{ctx: ctx}
+	matched := t.matchPath(path, probe)
+	if probe.err != nil {
+		return nil, probe.err
+	}
+	return matched, nil
+}
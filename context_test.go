@@ -0,0 +1,47 @@
+package trie
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTrieMatchContext(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := New()
+	node := tr.Define("/users/:id(^[0-9]+$)")
+	tr.Define("/static/a")
+	var misses int
+	tr.OnMiss(func(string, int) {
+		misses++
+	})
+
+	res, err := tr.MatchContext(context.Background(), "/users/42")
+	assert.Nil(err)
+	EqualPtr(t, node, res.Node)
+	assert.Equal("42", res.Params["id"])
+
+	res, err = tr.MatchContext(context.Background(), "/users/x")
+	assert.Nil(err)
+	assert.Nil(res.Node)
+	assert.Equal(1, misses)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err = tr.MatchContext(ctx, "/users/42")
+	assert.Nil(res)
+	assert.Equal(context.Canceled, err)
+	res, err = tr.MatchContext(ctx, "/static/a")
+	assert.Nil(res)
+	assert.Equal(context.Canceled, err)
+	assert.Equal(1, misses)
+
+	// the regexp evaluations are still counted
+	tr = New(Options{TrackRegexEvals: true})
+	tr.Define("/users/:id(^[0-9]+$)")
+	res, err = tr.MatchContext(context.Background(), "/users/42")
+	assert.Nil(err)
+	assert.Equal(1, res.RegexEvals)
+}
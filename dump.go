@@ -0,0 +1,49 @@
+package trie
+
+import (
+	"sort"
+	"strings"
+)
+
+// Dump returns the trie as an indented text tree for golden-file tests and
+// debugging. Every node is a line with its fragment as defined, indented by two
+// spaces for every level. Static children come sorted by key before the
+// parameter children in match order, like Walk. Endpoint nodes are followed by
+// their sorted method keys in brackets, and an alias by the pattern it resolves
+// to. The empty segment of a trailing slash is shown as "/".
+//
+//  trie.Define("/users/:id").Handle("GET", getUser)
+//  trie.Define("/users/").Handle("POST", createUser)
+//  trie.Dump()
+//  // users
+//  //   / [POST]
+//  //   :id [GET]
+//
+func (t *Trie) Dump() string {
+	var buf strings.Builder
+	for _, child := range t.root.getChildren() {
+		dumpNode(&buf, child, 0)
+	}
+	return buf.String()
+}
+
+func dumpNode(buf *strings.Builder, n *Node, depth int) {
+	buf.WriteString(strings.Repeat("  ", depth))
+	if n.segment == "" {
+		buf.WriteString("/")
+	} else {
+		buf.WriteString(n.segment)
+	}
+	if n.endpoint {
+		methods := append([]string(nil), n.loadHandlers().methods...)
+		sort.Strings(methods)
+		buf.WriteString(" [" + strings.Join(methods, ", ") + "]")
+	}
+	if n.aliasOf != nil {
+		buf.WriteString(" -> " + n.aliasOf.pattern)
+	}
+	buf.WriteByte('\n')
+	for _, child := range n.getChildren() {
+		dumpNode(buf, child, depth+1)
+	}
+}
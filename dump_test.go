@@ -0,0 +1,54 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTrieDump(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := New()
+	assert.Equal("", tr.Dump())
+
+	tr.Route("GET", "/", "index")
+	tr.Route("POST", "/api/users", "createUser")
+	tr.Route("GET", "/api/users", "listUsers")
+	tr.Route("GET", "/api/users/:id(^[0-9]+$)", "getUser")
+	tr.Route("DELETE", "/api/users/:id(^[0-9]+$)", "deleteUser")
+	tr.Route("GET", "/api/users/:name", "getUserByName")
+	tr.Route("GET", "/api/Teams/", "listTeams")
+	tr.Route("GET", "/files/:path*", "getFile")
+	tr.Define("/api/orphan")
+	assert.Nil(tr.Alias("/api/users/:name", "/u/:name"))
+
+	golden := `/ [GET]
+api
+  orphan []
+  Teams
+    / [GET]
+  users [GET, POST]
+    :id(^[0-9]+$) [DELETE, GET]
+    :name [GET]
+files
+  :path* [GET]
+u
+  :name [] -> /api/users/:name
+`
+	assert.Equal(golden, tr.Dump())
+
+	// the order of definition doesn't change the dump
+	other := New()
+	other.Route("GET", "/files/:path*", "getFile")
+	other.Define("/api/orphan")
+	other.Route("GET", "/api/Teams/", "listTeams")
+	other.Route("GET", "/api/users/:name", "getUserByName")
+	other.Route("DELETE", "/api/users/:id(^[0-9]+$)", "deleteUser")
+	other.Route("GET", "/api/users/:id(^[0-9]+$)", "getUser")
+	other.Route("GET", "/api/users", "listUsers")
+	other.Route("POST", "/api/users", "createUser")
+	other.Route("GET", "/", "index")
+	other.Alias("/api/users/:name", "/u/:name")
+	assert.Equal(golden, other.Dump())
+}
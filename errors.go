@@ -0,0 +1,48 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned or panicked by the trie, check them with errors.Is.
+var (
+	// ErrPathNotSlash is for a matching path that doesn't start with "/".
+	ErrPathNotSlash = errors.New(`path is not start with "/"`)
+	// ErrMultiSlash is for a pattern that contains "//".
+	ErrMultiSlash = errors.New("multi-slash exist")
+	// ErrInvalidPattern is for a malformed pattern fragment.
+	ErrInvalidPattern = errors.New("invalid pattern")
+	// ErrWildcardContinuation is for a pattern that continues after a catch-all parameter.
+	ErrWildcardContinuation = errors.New("can't define pattern after wildcard")
+	// ErrPatternConflict is for a parameter that conflicts with a defined sibling.
+	ErrPatternConflict = errors.New("pattern conflict")
+	// ErrHandlerExists is for a method that is already handled on the node.
+	ErrHandlerExists = errors.New("already defined")
+	// ErrMissingParam is for a parameter without value when building a path.
+	ErrMissingParam = errors.New("missing param")
+	// ErrInvalidParam is for a parameter value that the node doesn't match when building a path.
+	ErrInvalidParam = errors.New("invalid param")
+	// ErrFrozen is for a modification of a trie frozen by Trie.Freeze.
+	ErrFrozen = errors.New("trie is frozen")
+	// ErrNotDefined is for a pattern that is expected to be defined but isn't.
+	ErrNotDefined = errors.New("pattern not defined")
+)
+
+// routeError is an error with its own message that wraps one of the errors above.
+type routeError struct {
+	err error
+	msg string
+}
+
+func newError(err error, format string, args ...interface{}) error {
+	return &routeError{err: err, msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *routeError) Error() string {
+	return e.msg
+}
+
+func (e *routeError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,56 @@
+package trie
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func panicError(fn func()) (err error) {
+	defer func() {
+		err, _ = recover().(error)
+	}()
+	fn()
+	return nil
+}
+
+func TestGearTrieErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := New()
+	tr.Define("/a/:b*")
+	tr.Define("/c/:d").Handle("GET", func() {})
+
+	cases := []struct {
+		target error
+		fn     func()
+	}{
+		{ErrPathNotSlash, func() { tr.Match("a") }},
+		{ErrMultiSlash, func() { tr.Define("/a//b") }},
+		{ErrInvalidPattern, func() { tr.Define("/x/:") }},
+		{ErrInvalidPattern, func() { tr.Define("/x/(") }},
+		{ErrInvalidPattern, func() { tr.Define("/x/:y([a-)") }},
+		{ErrInvalidPattern, func() { New(Options{MaxRegexNesting: 1}).Define("/x/:y((a+)+)") }},
+		{ErrWildcardContinuation, func() { tr.Define("/a/:b*/c") }},
+		{ErrPatternConflict, func() { tr.Define("/a/:b") }},
+		{ErrPatternConflict, func() { tr.Define("/a/:b(x)") }},
+		{ErrPatternConflict, func() { tr.Define("/c/:e") }},
+		{ErrHandlerExists, func() { tr.Define("/c/:d").Handle("GET", func() {}) }},
+	}
+	for _, c := range cases {
+		err := panicError(c.fn)
+		assert.True(errors.Is(err, c.target), err)
+	}
+
+	err := panicError(func() { tr.Define("/a//b") })
+	assert.Equal(`multi-slash exist: "/a//b"`, err.Error())
+	assert.False(errors.Is(err, ErrInvalidPattern))
+
+	err = tr.LoadFrom(strings.NewReader("GET /c/:d"), func(method, pattern string) interface{} {
+		return method
+	})
+	assert.Equal(`line 1: "/c/:d" already defined`, err.Error())
+	assert.True(errors.Is(err, ErrHandlerExists))
+}
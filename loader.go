@@ -0,0 +1,121 @@
+package trie
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var methodReg = regexp.MustCompile(`^([A-Za-z]+|\*)$`)
+
+// LoadFrom reads routes from r and defines them on the trie. Each line holds a
+// method and a pattern separated by spaces, blank lines and lines starting
+// with "#" are ignored. The resolver maps every route to its handler.
+//
+//  // routes.txt
+//  // # users
+//  // GET /users/:id
+//  // PUT /users/:id
+//  err := trie.LoadFrom(file, func(method, pattern string) interface{} {
+//  	return handlers[method+" "+pattern]
+//  })
+//
+// It returns an error with the line number on the first malformed line, routes
+// on the lines before it remain defined.
+func (t *Trie) LoadFrom(r io.Reader, resolver func(method, pattern string) interface{}) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return fmt.Errorf(`line %d: invalid route "%s", expected "METHOD PATTERN"`, line, text)
+		}
+		if err := t.loadRoute(fields[0], fields[1], resolver); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (t *Trie) loadRoute(method, pattern string, resolver func(string, string) interface{}) (err error) {
+	handler := resolver(method, pattern)
+	if handler == nil {
+		return fmt.Errorf(`no handler for "%s %s"`, method, pattern)
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			var ok bool
+			if err, ok = e.(error); !ok {
+				err = fmt.Errorf("%v", e)
+			}
+		}
+	}()
+	t.define(t.root, pattern, 0).Handle(method, handler)
+	return nil
+}
+
+// DefineTree defines routes from a nested spec, such as one decoded from JSON
+// or YAML. Every key is a path fragment whose value is a nested spec, except
+// the empty key whose value holds the comma separated methods for the current
+// path. The resolver maps every route to its handler.
+//
+//  err := trie.DefineTree(map[string]interface{}{
+//  	"users": map[string]interface{}{
+//  		"":    "GET",
+//  		":id": map[string]interface{}{"": "GET,PUT"},
+//  	},
+//  }, resolver)
+//
+// It returns an error qualified with the pattern on the first malformed spec.
+func (t *Trie) DefineTree(spec map[string]interface{}, resolver func(method, pattern string) interface{}) error {
+	return t.defineTree("", spec, resolver)
+}
+
+func (t *Trie) defineTree(prefix string, spec map[string]interface{}, resolver func(string, string) interface{}) error {
+	keys := make([]string, 0, len(spec))
+	for key := range spec {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "" {
+			pattern := prefix
+			if pattern == "" {
+				pattern = "/"
+			}
+			methods, ok := spec[key].(string)
+			if !ok {
+				return fmt.Errorf(`"%s": invalid methods %#v`, pattern, spec[key])
+			}
+			for _, method := range strings.Split(methods, ",") {
+				method = strings.TrimSpace(method)
+				if !methodReg.MatchString(method) {
+					return fmt.Errorf(`"%s": invalid method "%s"`, pattern, method)
+				}
+				if err := t.loadRoute(method, pattern, resolver); err != nil {
+					return fmt.Errorf(`"%s": %w`, pattern, err)
+				}
+			}
+			continue
+		}
+
+		pattern := prefix + "/" + key
+		sub, ok := spec[key].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf(`"%s": invalid spec %#v`, pattern, spec[key])
+		}
+		if err := t.defineTree(pattern, sub, resolver); err != nil {
+			return err
+		}
+	}
+	return nil
+}
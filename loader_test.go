@@ -0,0 +1,114 @@
+package trie
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTrieLoadFrom(t *testing.T) {
+	resolver := func(method, pattern string) interface{} {
+		return method + " " + pattern
+	}
+
+	t.Run("load routes", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		err := tr.LoadFrom(strings.NewReader(`
+# users
+GET /users/:id
+PUT  /users/:id
+
+	POST /users
+`), resolver)
+		assert.Nil(err)
+
+		res := tr.Match("/users/123")
+		assert.Equal("123", res.Params["id"])
+		assert.Equal("GET /users/:id", res.Node.GetHandler("GET"))
+		assert.Equal("PUT /users/:id", res.Node.GetHandler("PUT"))
+		assert.Equal("GET, PUT", res.Node.GetAllow())
+		assert.Equal("POST /users", tr.Match("/users").Node.GetHandler("POST"))
+	})
+
+	t.Run("malformed routes", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		err := tr.LoadFrom(strings.NewReader("# users\nGET /users/:id\nGET\n"), resolver)
+		assert.Equal(`line 3: invalid route "GET", expected "METHOD PATTERN"`, err.Error())
+		assert.NotNil(tr.Match("/users/123").Node)
+
+		err = tr.LoadFrom(strings.NewReader("GET /users//x"), resolver)
+		assert.Equal(`line 1: multi-slash exist: "/users//x"`, err.Error())
+
+		err = tr.LoadFrom(strings.NewReader("\nGET /users/:id"), resolver)
+		assert.Equal(`line 2: "/users/:id" already defined`, err.Error())
+
+		err = tr.LoadFrom(strings.NewReader("GET /posts"), func(method, pattern string) interface{} {
+			return nil
+		})
+		assert.Equal(`line 1: no handler for "GET /posts"`, err.Error())
+	})
+}
+
+func TestGearTrieDefineTree(t *testing.T) {
+	resolver := func(method, pattern string) interface{} {
+		return method + " " + pattern
+	}
+
+	t.Run("define nested spec", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		err := tr.DefineTree(map[string]interface{}{
+			"": "GET",
+			"users": map[string]interface{}{
+				"": "GET, POST",
+				":id": map[string]interface{}{
+					"":      "GET,PUT",
+					"posts": map[string]interface{}{"": "GET"},
+				},
+			},
+		}, resolver)
+		assert.Nil(err)
+
+		assert.Equal("GET /", tr.Match("/").Node.GetHandler("GET"))
+		assert.Equal("GET, POST", tr.Match("/users").Node.GetAllow())
+		res := tr.Match("/users/123")
+		assert.Equal("123", res.Params["id"])
+		assert.Equal("PUT /users/:id", res.Node.GetHandler("PUT"))
+		assert.Equal("GET /users/:id/posts", tr.Match("/users/123/posts").Node.GetHandler("GET"))
+	})
+
+	t.Run("malformed spec", func(t *testing.T) {
+		assert := assert.New(t)
+
+		err := New().DefineTree(map[string]interface{}{
+			"users": map[string]interface{}{":id": map[string]interface{}{"": "GET,P UT"}},
+		}, resolver)
+		assert.Equal(`"/users/:id": invalid method "P UT"`, err.Error())
+
+		err = New().DefineTree(map[string]interface{}{
+			"users": map[string]interface{}{"": []string{"GET"}},
+		}, resolver)
+		assert.Equal(`"/users": invalid methods []string{"GET"}`, err.Error())
+
+		err = New().DefineTree(map[string]interface{}{
+			"users": "GET",
+		}, resolver)
+		assert.Equal(`"/users": invalid spec "GET"`, err.Error())
+
+		err = New().DefineTree(map[string]interface{}{
+			"users": map[string]interface{}{"": "GET,GET"},
+		}, resolver)
+		assert.Equal(`"/users": "/users" already defined`, err.Error())
+
+		err = New().DefineTree(map[string]interface{}{
+			":a*": map[string]interface{}{"b": map[string]interface{}{"": "GET"}},
+		}, resolver)
+		assert.Equal(`"/:a*/b": can't define pattern after wildcard: "/:a*"`, err.Error())
+	})
+}
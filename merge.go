@@ -0,0 +1,107 @@
+package trie
+
+import "fmt"
+
+// Merge overlays the routes of other onto the trie at the root. Nodes and
+// handlers only defined by other are added. When both tries mount a handler with
+// the same method on the same endpoint, onConflict is called with the pattern,
+// the method, the handler of the trie and the handler of other, and its result
+// is mounted. If onConflict is nil, Merge returns an error for the conflict.
+// Merge stops on the first error and the trie may have been partially merged.
+//
+//  base.Merge(overrides, func(pattern, method string, a, b interface{}) interface{} {
+//  	return b
+//  })
+//
+func (t *Trie) Merge(other *Trie, onConflict func(pattern, method string, a, b interface{}) interface{}) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			var ok bool
+			if err, ok = e.(error); !ok {
+				err = fmt.Errorf("%v", e)
+			}
+		}
+	}()
+	t.checkFrozen()
+	t.mergeNode(t.root, other.root, onConflict)
+	return nil
+}
+
+func (t *Trie) mergeNode(dst, src *Node, onConflict func(string, string, interface{}, interface{}) interface{}) {
+	if src.literal {
+		dst.literal = true
+	}
+	if src.exact {
+		dst.exact = true
+	}
+	// aliases are not kept, see Trie.Alias
+	if src.endpoint && src.aliasOf == nil {
+		dst.setEndpoint()
+		if dst.pattern == "" {
+			dst.pattern = src.pattern
+		}
+	}
+	set := src.loadHandlers()
+	for _, method := range set.methods {
+		handler := set.handlers[method]
+		existing := dst.GetHandler(method)
+		if existing == nil {
+			dst.Handle(method, handler)
+			continue
+		}
+		if onConflict == nil {
+			panic(newError(ErrHandlerExists, `"%s" already defined in "%s"`, method, dst.getSegments()))
+		}
+		dst.setHandler(t.normalizeMethod(method), onConflict(dst.getSegments(), method, existing, handler))
+	}
+	for method, handler := range src.subtreeHandlers {
+		existing := dst.subtreeHandlers[t.normalizeMethod(method)]
+		if existing == nil {
+			dst.HandleSubtree(method, handler)
+			continue
+		}
+		if onConflict == nil {
+			panic(newError(ErrHandlerExists, `"%s" subtree handler already defined in "%s"`, method, dst.getSegments()))
+		}
+		dst.subtreeHandlers[t.normalizeMethod(method)] = onConflict(dst.getSegments(), method, existing, handler)
+	}
+	if len(dst.queries) == 0 {
+		dst.queries = src.queries
+	}
+	if len(dst.validators) == 0 {
+		dst.validators = src.validators
+	}
+	if len(dst.transforms) == 0 {
+		dst.transforms = src.transforms
+	}
+	if len(dst.constraints) == 0 {
+		dst.constraints = src.constraints
+	}
+	if len(dst.onMatch) == 0 {
+		dst.onMatch = src.onMatch
+	}
+	for param, value := range src.defaults {
+		if _, ok := dst.defaults[param]; !ok {
+			dst.SetDefault(param, value)
+		}
+	}
+	if dst.enabled == nil && src.enabled != nil {
+		dst.SetEnabled(src.enabled)
+	}
+	if dst.delegate == nil && src.delegate != nil {
+		dst.Delegate(src.delegate)
+	}
+	if dst.notFound == nil {
+		dst.notFound = src.notFound
+	}
+	if src.fallback && !dst.fallback {
+		dst.Fallback()
+	}
+	if dst.priority == 0 && src.priority != 0 {
+		dst.Priority(src.priority)
+	}
+
+	for _, child := range src.getChildren() {
+		t.mergeNode(parseNode(dst, child.segment, t.ignoreCase), child, onConflict)
+	}
+}
@@ -0,0 +1,103 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTrieMerge(t *testing.T) {
+	t.Run("Merge method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		base := New()
+		base.Route("GET", "/users/:id", "base get user")
+		base.Route("PUT", "/users/:id", "base put user")
+		base.Route("GET", "/teams", "base teams")
+
+		overrides := New()
+		overrides.Route("GET", "/users/:id", "override get user")
+		overrides.Route("DELETE", "/users/:id", "override delete user")
+		overrides.Route("GET", "/projects/:id(^\\d+$)", "override project")
+		overrides.Route("GET", "/files/:path*", "override files")
+
+		var conflicts []string
+		err := base.Merge(overrides, func(pattern, method string, a, b interface{}) interface{} {
+			conflicts = append(conflicts, method+" "+pattern)
+			assert.Equal("base get user", a)
+			return b
+		})
+		assert.Nil(err)
+		assert.Equal([]string{"GET /users/:id"}, conflicts)
+
+		res := base.Match("/users/123")
+		assert.Equal("/users/:id", res.Pattern)
+		assert.Equal("override get user", res.Handler("GET"))
+		assert.Equal("base put user", res.Handler("PUT"))
+		assert.Equal("override delete user", res.Handler("DELETE"))
+		assert.Equal("GET, PUT, DELETE", res.Node.GetAllow())
+
+		assert.Equal("base teams", base.Match("/teams").Handler("GET"))
+		assert.Equal("override project", base.Match("/projects/1").Handler("GET"))
+		assert.Nil(base.Match("/projects/x").Node)
+		res = base.Match("/files/a/b")
+		assert.Equal("override files", res.Handler("GET"))
+		assert.Equal("a/b", res.Params["path"])
+
+		assert.Nil(overrides.Match("/teams").Node)
+	})
+
+	t.Run("Merge without onConflict", func(t *testing.T) {
+		assert := assert.New(t)
+
+		base := New()
+		base.Route("GET", "/a", "a")
+		other := New()
+		other.Route("GET", "/b", "b")
+		assert.Nil(base.Merge(other, nil))
+		assert.Equal("b", base.Match("/b").Handler("GET"))
+
+		other.Route("GET", "/a", "other a")
+		err := base.Merge(other, nil)
+		assert.ErrorIs(err, ErrHandlerExists)
+		assert.Equal("a", base.Match("/a").Handler("GET"))
+	})
+
+	t.Run("Merge with pattern conflict", func(t *testing.T) {
+		assert := assert.New(t)
+
+		base := New()
+		base.Define("/a/:id")
+		other := New()
+		other.Define("/a/:name")
+		assert.ErrorIs(base.Merge(other, nil), ErrPatternConflict)
+	})
+
+	t.Run("Merge node settings", func(t *testing.T) {
+		assert := assert.New(t)
+
+		other := New()
+		other.Define("/lit").Literal()
+		other.Define("/lit/:x")
+		other.Define("/country/:code").Validate(func(code string) bool {
+			return code == "cn"
+		})
+		other.Define("/country").HandleSubtree("GET", "country")
+
+		base := New()
+		assert.Nil(base.Merge(other, nil))
+		assert.NotNil(base.Match("/lit/:x").Node)
+		assert.Nil(base.Match("/lit/y").Node)
+		assert.NotNil(base.Match("/country/cn").Node)
+		assert.Nil(base.Match("/country/us").Node)
+		assert.Equal("country", base.Match("/country/cn").Handler("GET"))
+
+		other = New()
+		other.Define("/x/:id").SetEnabled(func() bool { return false })
+		other.Define("/x/:rest*")
+		base = New()
+		base.Define("/x/:id")
+		assert.Nil(base.Merge(other, nil))
+		assert.Equal("/x/:rest*", base.Match("/x/1").Node.GetPattern())
+	})
+}
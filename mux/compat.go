@@ -0,0 +1,36 @@
+package mux
+
+import "net/http"
+
+// Context is the matched route of a request handled by an adapter registered
+// with Mux.ContextHandler, it is returned by RouteContext.
+type Context struct {
+	// The pattern of the matched route, such as "/users/:id".
+	Pattern string
+	// The params captured from the request path.
+	Params Params
+}
+
+// RouteContext returns the matched route stored in the request context by an
+// adapter registered with Mux.ContextHandler, or nil. It is like chi.RouteContext
+// to ease the migration of chi handlers.
+//
+//  rctx := mux.RouteContext(req)
+//  rctx.Pattern // "/users/:id"
+//
+func RouteContext(req *http.Request) *Context {
+	rctx, _ := req.Context().Value(routeContextKey{}).(*Context)
+	return rctx
+}
+
+// URLParam returns the value of the param stored in the request context by an
+// adapter registered with Mux.ContextHandler, or an empty string. It is like
+// chi.URLParam to ease the migration of chi handlers.
+//
+//  mux.ContextHandler("GET", "/users/:id", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+//  	id := mux.URLParam(req, "id")
+//  }))
+//
+func URLParam(req *http.Request, key string) string {
+	return ParamsFromContext(req.Context())[key]
+}
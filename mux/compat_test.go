@@ -0,0 +1,40 @@
+package mux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompat(t *testing.T) {
+	t.Run("URLParam and RouteContext", func(t *testing.T) {
+		assert := assert.New(t)
+
+		mux := New()
+		mux.ContextHandler("GET", "users/:id/repos/:repo", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			rctx := RouteContext(req)
+			w.Header().Set("X-Pattern", rctx.Pattern)
+			w.Write([]byte(URLParam(req, "id") + "/" + URLParam(req, "repo") + "/" + URLParam(req, "none")))
+		}))
+		mux.HandlerFunc("GET", "/plain/:id", func(w http.ResponseWriter, req *http.Request) {
+			if RouteContext(req) != nil || URLParam(req, "id") != "" {
+				w.WriteHeader(500)
+			}
+		})
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/users/42/repos/trie", nil))
+		assert.Equal(200, w.Code)
+		assert.Equal("/users/:id/repos/:repo", w.Header().Get("X-Pattern"))
+		assert.Equal("42/trie/", w.Body.String())
+
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/plain/42", nil))
+		assert.Equal(200, w.Code)
+
+		assert.Nil(RouteContext(httptest.NewRequest("GET", "/", nil)))
+		assert.Equal("", URLParam(httptest.NewRequest("GET", "/", nil), "id"))
+	})
+}
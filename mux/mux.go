@@ -1,6 +1,7 @@
 package mux
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
@@ -11,6 +12,20 @@ import (
 // Params represents named parameter values
 type Params map[string]string
 
+type routeContextKey struct{}
+
+// ParamsFromContext returns the params stored in the request context by an
+// adapter registered with Mux.ContextHandler, or nil.
+//
+//  params := mux.ParamsFromContext(req.Context())
+//
+func ParamsFromContext(ctx context.Context) Params {
+	if rctx, ok := ctx.Value(routeContextKey{}).(*Context); ok {
+		return rctx.Params
+	}
+	return nil
+}
+
 // HandlerFunc is a function that can be registered to a route to handle HTTP
 // requests. Like http.HandlerFunc, but has a third parameter for the values of
 // wildcards (variables).
@@ -97,6 +112,19 @@ func (m *Mux) HandlerFunc(method, path string, handler http.HandlerFunc) {
 	m.Handler(method, path, handler)
 }
 
+// ContextHandler is an adapter which allows the usage of an http.Handler as a
+// request handle, and stores the params and the route pattern in the request
+// context that can be read by ParamsFromContext, RouteContext and URLParam. It
+// costs a context allocation for each request, handlers with the HandlerFunc
+// signature receive the params directly instead.
+func (m *Mux) ContextHandler(method, path string, handler http.Handler) {
+	pattern := m.trie.Define(path).GetPattern()
+	m.Handle(method, path, func(w http.ResponseWriter, req *http.Request, params Params) {
+		rctx := &Context{Pattern: pattern, Params: params}
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), routeContextKey{}, rctx)))
+	})
+}
+
 // ServeHTTP implemented http.Handler interface
 func (m *Mux) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	var handler HandlerFunc
@@ -106,11 +134,8 @@ func (m *Mux) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	if res.Node == nil {
 		// FixedPathRedirect or TrailingSlashRedirect
-		if res.TSR != "" || res.FPR != "" {
-			req.URL.Path = res.TSR
-			if res.FPR != "" {
-				req.URL.Path = res.FPR
-			}
+		if target, ok := res.RedirectTarget(); ok {
+			req.URL.Path = target
 			code := 301
 			if method != "GET" {
 				code = 307
@@ -645,4 +645,54 @@ func TestMux(t *testing.T) {
 		mux.ServeHTTP(w, req)
 		assert.Equal(501, w.Code)
 	})
+
+	t.Run("Mux.ContextHandler", func(t *testing.T) {
+		assert := assert.New(t)
+
+		mux := New()
+		mux.ContextHandler("GET", "/users/:user/repos/:repo", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			params := ParamsFromContext(req.Context())
+			w.WriteHeader(200)
+			w.Write([]byte(params["user"] + "/" + params["repo"]))
+		}))
+		mux.HandlerFunc("GET", "/none", func(w http.ResponseWriter, req *http.Request) {
+			if ParamsFromContext(req.Context()) != nil {
+				w.WriteHeader(500)
+			}
+		})
+
+		req := httptest.NewRequest("GET", "/users/tom/repos/trie", nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(200, w.Code)
+		assert.Equal("tom/trie", w.Body.String())
+
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/none", nil))
+		assert.Equal(200, w.Code)
+	})
+
+	t.Run("typed HandlerFunc dispatch with params", func(t *testing.T) {
+		assert := assert.New(t)
+
+		mux := New()
+		mux.Get("/users/:user/repos/:repo", func(w http.ResponseWriter, req *http.Request, params Params) {
+			w.WriteHeader(200)
+			w.Write([]byte(params["user"] + "/" + params["repo"]))
+		})
+		mux.Post("/files/:path*", func(w http.ResponseWriter, req *http.Request, params Params) {
+			w.WriteHeader(201)
+			w.Write([]byte(params["path"]))
+		})
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/users/tom/repos/trie", nil))
+		assert.Equal(200, w.Code)
+		assert.Equal("tom/trie", w.Body.String())
+
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", "/files/a/b.txt", nil))
+		assert.Equal(201, w.Code)
+		assert.Equal("a/b.txt", w.Body.String())
+	})
 }
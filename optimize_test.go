@@ -0,0 +1,115 @@
+package trie
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTrieOptimize(t *testing.T) {
+	patterns := []string{
+		"/files/:id(^[0-9]*$)",
+		"/files/:hex(^(?i)[0-9a-f]+$)",
+		"/files/:name(^([a-z]+)-([a-z]+)$)",
+		"/files/:any(x$)",
+		"/files/:code(^[A-Z]{3}$)",
+		"/files/:sub(^s[0-9]$)/:rest*",
+		"/files/:other",
+		"/files/static",
+		"/v/:a(^a+$)+edit",
+		"/v/:b(^b+$)",
+		"/v/:c(^c+$)",
+		"/v/:d(^d+$).:ext",
+	}
+	paths := []string{
+		"/files/123", "/files/abc", "/files/ABC", "/files/AbC9", "/files/ab-cd",
+		"/files/box", "/files/XYZ", "/files/s1/a/b", "/files/s1", "/files/zz",
+		"/files/static", "/files/Static", "/files/123/", "/files//123", "/files/",
+		"/v/aa+edit", "/v/bb", "/v/cc", "/v/dd.json", "/v/ee", "/v/BB",
+	}
+
+	for _, opts := range []Options{{}, defaultOptions, {StrictEmptyParams: true}} {
+		plain := New(opts)
+		optimized := New(opts)
+		for _, pattern := range patterns {
+			plain.Define(pattern)
+			optimized.Define(pattern)
+		}
+		optimized.Optimize()
+
+		for _, path := range paths {
+			expected := plain.Match(path)
+			actual := optimized.Match(path)
+			if expected.Node == nil {
+				assert.Nil(t, actual.Node, path)
+			} else {
+				assert.Equal(t, expected.Node.GetPattern(), actual.Node.GetPattern(), path)
+			}
+			assert.Equal(t, expected.Params, actual.Params, path)
+			assert.Equal(t, expected.TSR, actual.TSR, path)
+			assert.Equal(t, expected.FPR, actual.FPR, path)
+		}
+	}
+
+	t.Run("Only anchored regexps without suffix are combined", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		id := tr.Define("/files/:id(^[0-9]+$)")
+		tr.Define("/files/:hex(^(?i)[0-9a-f]+$)")
+		tr.Define("/files/:any(x$)")
+		tr.Define("/files/:code(^[A-Z]{3}$)")
+		tr.Define("/files/:lower(^[a-z]{3}$)")
+		tr.Define("/files/:last(^z$)").Validate(func(string) bool { return true })
+		tr.Optimize()
+		assert.True(tr.Frozen())
+
+		var groups []int
+		for _, child := range id.parent.varyChildren {
+			if child.regexGroup != nil {
+				groups = append(groups, len(child.regexGroup.nodes))
+			}
+		}
+		assert.Equal([]int{2, 2}, groups)
+
+		assert.Equal("/files/:hex(^(?i)[0-9a-f]+$)", tr.Match("/files/aF").Node.GetPattern())
+		assert.Equal("/files/:any(x$)", tr.Match("/files/box").Node.GetPattern())
+		assert.Equal("/files/:lower(^[a-z]{3}$)", tr.Match("/files/bob").Node.GetPattern())
+		assert.Equal("/files/:last(^z$)", tr.Match("/files/z").Node.GetPattern())
+		assert.Nil(tr.Match("/files/y").Node)
+
+		assert.Panics(func() {
+			tr.Define("/files/:more(^m$)")
+		})
+	})
+
+	t.Run("MatchTrace and RegexEvals use the combined regexps", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{TrackRegexEvals: true})
+		tr.Define("/files/:id(^[0-9]+$)")
+		tr.Define("/files/:name(^[a-z]+$)")
+		tr.Define("/files/:code(^[A-Z]{3}$)")
+
+		assert.Equal(3, tr.Match("/files/XYZ").RegexEvals)
+		assert.Equal(3, tr.Match("/files/-").RegexEvals)
+		tr.Optimize()
+		assert.Equal(1, tr.Match("/files/XYZ").RegexEvals)
+		assert.Equal(1, tr.Match("/files/-").RegexEvals)
+
+		res, steps := tr.MatchTrace("/files/abc")
+		assert.Equal("/files/:name(^[a-z]+$)", res.Pattern)
+		assert.Equal(1, res.RegexEvals)
+		assert.Equal([]TraceStep{
+			{"files", "static", "/files", true},
+			{"abc", "regex", "/files/:id(^[0-9]+$)", false},
+			{"abc", "regex", "/files/:name(^[a-z]+$)", true},
+		}, steps)
+
+		res, err := tr.MatchContext(context.Background(), "/files/-")
+		assert.Nil(err)
+		assert.Nil(res.Node)
+		assert.Equal(1, res.RegexEvals)
+	})
+}
@@ -0,0 +1,223 @@
+package trie
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+type snapshot struct {
+	Options snapshotOptions `json:"options"`
+	LastID  int             `json:"lastID"`
+	Root    snapshotNode    `json:"root"`
+}
+
+type snapshotOptions struct {
+	IgnoreCase               bool     `json:"ignoreCase,omitempty"`
+	FixedPathRedirect        bool     `json:"fixedPathRedirect,omitempty"`
+	TrailingSlashRedirect    bool     `json:"trailingSlashRedirect,omitempty"`
+	IgnoreMethodCase         bool     `json:"ignoreMethodCase,omitempty"`
+	MaxRegexNesting          int      `json:"maxRegexNesting,omitempty"`
+	WildcardLeadingSlash     bool     `json:"wildcardLeadingSlash,omitempty"`
+	AnonymousParams          bool     `json:"anonymousParams,omitempty"`
+	MaxParams                int      `json:"maxParams,omitempty"`
+	TrackRegexEvals          bool     `json:"trackRegexEvals,omitempty"`
+	RPCMethods               []string `json:"rpcMethods,omitempty"`
+	RegexFlags               string   `json:"regexFlags,omitempty"`
+	ParamNameRegex           string   `json:"paramNameRegex,omitempty"`
+	TenantPrefix             string   `json:"tenantPrefix,omitempty"`
+	VariantSeparator         string   `json:"variantSeparator,omitempty"`
+	NormalizePercentEncoding bool     `json:"normalizePercentEncoding,omitempty"`
+	RegexFirst               bool     `json:"regexFirst,omitempty"`
+	StrictEmptyParams        bool     `json:"strictEmptyParams,omitempty"`
+}
+
+type snapshotNode struct {
+	Segment  string            `json:"segment"`
+	Pattern  string            `json:"pattern,omitempty"`
+	ID       int               `json:"id,omitempty"`
+	Endpoint bool              `json:"endpoint,omitempty"`
+	Literal  bool              `json:"literal,omitempty"`
+	Exact    bool              `json:"exact,omitempty"`
+	Priority int               `json:"priority,omitempty"`
+	Fallback bool              `json:"fallback,omitempty"`
+	Methods  []string          `json:"methods,omitempty"`
+	Defaults map[string]string `json:"defaults,omitempty"`
+	Queries  [][2]string       `json:"queries,omitempty"`
+	Children []snapshotNode    `json:"children,omitempty"`
+}
+
+// Snapshot encodes the trie without handlers, it can be restored by LoadSnapshot
+// faster than defining the patterns again. It includes the options, the nodes
+// with their patterns, parameter fragments, methods, IDs, priorities, fallbacks, defaults
+// and query constraints. Functions are not included: Options.CaseFold,
+// validators, transforms, the constraints of Node.Constrain, the hooks of Node.OnMatch,
+// delegates, predicates of Node.SetEnabled, middleware and the handlers of
+// Node.HandleSubtree, Node.SetNotFound, SetNotFound and SetMethodNotAllowed.
+//
+//  data, err := trie.Snapshot()
+//
+func (t *Trie) Snapshot() ([]byte, error) {
+	opts := t.options
+	s := snapshot{
+		Options: snapshotOptions{
+			IgnoreCase:               opts.IgnoreCase,
+			FixedPathRedirect:        opts.FixedPathRedirect,
+			TrailingSlashRedirect:    opts.TrailingSlashRedirect,
+			IgnoreMethodCase:         opts.IgnoreMethodCase,
+			MaxRegexNesting:          opts.MaxRegexNesting,
+			WildcardLeadingSlash:     opts.WildcardLeadingSlash,
+			AnonymousParams:          opts.AnonymousParams,
+			MaxParams:                opts.MaxParams,
+			TrackRegexEvals:          opts.TrackRegexEvals,
+			RPCMethods:               opts.RPCMethods,
+			RegexFlags:               opts.RegexFlags,
+			TenantPrefix:             opts.TenantPrefix,
+			VariantSeparator:         opts.VariantSeparator,
+			NormalizePercentEncoding: opts.NormalizePercentEncoding,
+			RegexFirst:               opts.RegexFirst,
+			StrictEmptyParams:        opts.StrictEmptyParams,
+		},
+		LastID: t.lastID,
+		Root:   snapshotOf(t.root),
+	}
+	if opts.ParamNameRegex != nil {
+		s.Options.ParamNameRegex = opts.ParamNameRegex.String()
+	}
+	return json.Marshal(s)
+}
+
+func snapshotOf(n *Node) snapshotNode {
+	if n.aliasOf != nil {
+		// aliases are not kept, the node is restored only for the nodes below it
+		s := snapshotNode{Segment: n.segment}
+		s.Children = snapshotChildren(n)
+		return s
+	}
+	s := snapshotNode{
+		Segment:  n.segment,
+		Pattern:  n.pattern,
+		ID:       n.id,
+		Endpoint: n.endpoint,
+		Literal:  n.literal && (n.parent == nil || !n.parent.literal),
+		Exact:    n.exact,
+		Priority: n.priority,
+		Fallback: n.fallback,
+		Methods:  n.loadHandlers().methods,
+		Defaults: n.defaults,
+	}
+	for _, query := range n.queries {
+		s.Queries = append(s.Queries, [2]string{query.key, query.regex.String()})
+	}
+	s.Children = snapshotChildren(n)
+	return s
+}
+
+// snapshotChildren returns the snapshots of the children of the node, leaving
+// out the alias nodes without children.
+func snapshotChildren(n *Node) []snapshotNode {
+	var children []snapshotNode
+	for _, child := range n.getChildren() {
+		if child.aliasOf != nil && len(child.getChildren()) == 0 {
+			continue
+		}
+		children = append(children, snapshotOf(child))
+	}
+	return children
+}
+
+// LoadSnapshot restores a trie from the data encoded by Trie.Snapshot, and
+// mounts the handlers returned by resolver for the pattern and method of each
+// handler in the snapshot. It returns an error if the data is invalid or the
+// resolver returns nil.
+//
+//  trie, err := LoadSnapshot(data, func(pattern, method string) interface{} {
+//  	return handlers[method+" "+pattern]
+//  })
+//
+func LoadSnapshot(data []byte, resolver func(pattern, method string) interface{}) (t *Trie, err error) {
+	var s snapshot
+	if err = json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+
+	opts := Options{
+		IgnoreCase:               s.Options.IgnoreCase,
+		FixedPathRedirect:        s.Options.FixedPathRedirect,
+		TrailingSlashRedirect:    s.Options.TrailingSlashRedirect,
+		IgnoreMethodCase:         s.Options.IgnoreMethodCase,
+		MaxRegexNesting:          s.Options.MaxRegexNesting,
+		WildcardLeadingSlash:     s.Options.WildcardLeadingSlash,
+		AnonymousParams:          s.Options.AnonymousParams,
+		MaxParams:                s.Options.MaxParams,
+		TrackRegexEvals:          s.Options.TrackRegexEvals,
+		RPCMethods:               s.Options.RPCMethods,
+		RegexFlags:               s.Options.RegexFlags,
+		TenantPrefix:             s.Options.TenantPrefix,
+		VariantSeparator:         s.Options.VariantSeparator,
+		NormalizePercentEncoding: s.Options.NormalizePercentEncoding,
+		RegexFirst:               s.Options.RegexFirst,
+		StrictEmptyParams:        s.Options.StrictEmptyParams,
+	}
+	if s.Options.ParamNameRegex != "" {
+		if opts.ParamNameRegex, err = regexp.Compile(s.Options.ParamNameRegex); err != nil {
+			return nil, err
+		}
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			var ok bool
+			if err, ok = e.(error); !ok {
+				err = fmt.Errorf("%v", e)
+			}
+			t = nil
+		}
+	}()
+	t = New(opts)
+	if err = t.restoreNode(t.root, s.Root, resolver); err != nil {
+		return nil, err
+	}
+	t.lastID = s.LastID
+	return t, nil
+}
+
+func (t *Trie) restoreNode(n *Node, s snapshotNode, resolver func(string, string) interface{}) error {
+	if s.Literal {
+		n.Literal()
+	}
+	if s.Exact {
+		n.Exact()
+	}
+	if s.Priority != 0 {
+		n.Priority(s.Priority)
+	}
+	if s.Fallback {
+		n.Fallback()
+	}
+	if s.Endpoint {
+		n.endpoint = true
+		n.id = s.ID
+		n.pattern = s.Pattern
+	}
+	for param, value := range s.Defaults {
+		n.SetDefault(param, value)
+	}
+	for _, query := range s.Queries {
+		n.RequireQuery(query[0], query[1])
+	}
+	for _, method := range s.Methods {
+		handler := resolver(s.Pattern, method)
+		if handler == nil {
+			return fmt.Errorf(`no handler for "%s %s"`, method, s.Pattern)
+		}
+		n.Handle(method, handler)
+	}
+
+	for _, child := range s.Children {
+		if err := t.restoreNode(parseNode(n, child.Segment, t.ignoreCase), child, resolver); err != nil {
+			return err
+		}
+	}
+	return nil
+}
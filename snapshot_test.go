@@ -0,0 +1,118 @@
+package trie
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTrieSnapshot(t *testing.T) {
+	t.Run("Snapshot and LoadSnapshot round trip", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{
+			IgnoreCase:            true,
+			FixedPathRedirect:     true,
+			TrailingSlashRedirect: true,
+			ParamNameRegex:        regexp.MustCompile(`^[\w-]+$`),
+		})
+		routes := []string{
+			"/",
+			"/users/:user-id",
+			"/users/:user-id/repos/:repo(^[a-z]+$)",
+			"/files/:name+.json",
+			"/files/:path*",
+			"/a/::b/",
+			`/emoji/\(o_o\)`,
+			"/search/:q/",
+		}
+		for _, route := range routes {
+			tr.Route("GET", route, "GET "+route)
+		}
+		tr.Route("PUT", "/users/:user-id", "PUT /users/:user-id")
+		tr.Define("/lit").Literal()
+		tr.Route("GET", "/lit/:x", "GET /lit/:x")
+		tr.Define("/hook").Exact()
+		tr.Define("/p/:low(^[a-z]+$)")
+		tr.Define("/p/:high").Priority(1)
+		tr.Define("/posts/:page").SetDefault("page", "1")
+		tr.Define("/q").RequireQuery("type", "^image$")
+
+		data, err := tr.Snapshot()
+		assert.Nil(err)
+		restored, err := LoadSnapshot(data, func(pattern, method string) interface{} {
+			return method + " " + pattern
+		})
+		assert.Nil(err)
+		assert.Equal(tr.Options().IgnoreCase, restored.Options().IgnoreCase)
+		assert.Equal(tr.Len(), restored.Len())
+
+		paths := []string{"/", "/users/tom", "/USERS/tom/", "/users/tom/repos/trie", "/users/tom/repos/123",
+			"/files/a.json", "/files/a/b", "/a/:b/", "/a/:b", "/emoji/(o_o)", "/search/x", "/lit/:x",
+			"/lit/y", "/hook", "/hook/", "/p/abc", "/posts/2", "/x", "//users//tom"}
+		for _, path := range paths {
+			expected, res := tr.Match(path), restored.Match(path)
+			assert.Equal(expected.Pattern, res.Pattern, path)
+			assert.Equal(expected.Params, res.Params, path)
+			assert.Equal(expected.TSR, res.TSR, path)
+			assert.Equal(expected.FPR, res.FPR, path)
+			assert.Equal(expected.Handler("GET"), res.Handler("GET"), path)
+			assert.Equal(expected.Handler("PUT"), res.Handler("PUT"), path)
+			if expected.Node != nil {
+				assert.Equal(expected.Node.ID(), res.Node.ID(), path)
+				assert.Equal(expected.Node.GetAllow(), res.Node.GetAllow(), path)
+			}
+		}
+
+		path, err := restored.Match("/posts/2").Node.BuildPath(nil)
+		assert.Nil(err)
+		assert.Equal("/posts/1", path)
+		assert.Nil(restored.MatchQuery("/q", nil).Node)
+
+		node := restored.Define("/new")
+		assert.Equal(tr.Define("/new").ID(), node.ID())
+
+		data2, err := restored.Snapshot()
+		assert.Nil(err)
+		data, _ = tr.Snapshot()
+		assert.Equal(string(data), string(data2))
+	})
+
+	t.Run("LoadSnapshot errors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := LoadSnapshot([]byte("{"), nil)
+		assert.NotNil(err)
+
+		tr := New()
+		tr.Route("GET", "/a", "a")
+		data, _ := tr.Snapshot()
+		_, err = LoadSnapshot(data, func(pattern, method string) interface{} {
+			return nil
+		})
+		assert.NotNil(err)
+
+		_, err = LoadSnapshot([]byte(`{"root":{"children":[{"segment":"(x"}]}}`), nil)
+		assert.ErrorIs(err, ErrInvalidPattern)
+	})
+
+	t.Run("Snapshot keeps TenantPrefix", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{TenantPrefix: "/t/:tenant", FixedPathRedirect: true})
+		tr.Route("GET", "/users/:id", "getUser")
+		data, err := tr.Snapshot()
+		assert.Nil(err)
+
+		restored, err := LoadSnapshot(data, func(pattern, method string) interface{} {
+			return method + " " + pattern
+		})
+		assert.Nil(err)
+		assert.Equal("/t/:tenant", restored.Options().TenantPrefix)
+		res := restored.Match("/t/acme/users/1")
+		assert.Equal("GET /users/:id", res.Node.GetHandler("GET"))
+		assert.Equal(map[string]string{"tenant": "acme", "id": "1"}, res.Params)
+		assert.Nil(restored.Match("/users/1").Node)
+	})
+}
@@ -0,0 +1,70 @@
+package trie
+
+import "sort"
+
+// Suggest returns up to max defined patterns that are closest to the path,
+// ordered by Levenshtein distance and then lexically. It can be used to build
+// "did you mean" responses for unmatched paths.
+//
+//  trie.Define("/api/users")
+//  trie.Suggest("/api/usrs", 1) // []string{"/api/users"}
+//
+func (t *Trie) Suggest(path string, max int) []string {
+	if max <= 0 {
+		return nil
+	}
+
+	type candidate struct {
+		pattern  string
+		distance int
+	}
+	var candidates []candidate
+	t.WalkFunc(func(pattern string, n *Node) bool {
+		if n.endpoint {
+			candidates = append(candidates, candidate{pattern, levenshtein(path, pattern)})
+		}
+		return true
+	})
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].pattern < candidates[j].pattern
+	})
+
+	if len(candidates) > max {
+		candidates = candidates[:max]
+	}
+	res := make([]string, len(candidates))
+	for i, c := range candidates {
+		res[i] = c.pattern
+	}
+	return res
+}
+
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	curr := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		curr[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if d := prev[j] + 1; d < curr[j] {
+				curr[j] = d
+			}
+			if d := curr[j-1] + 1; d < curr[j] {
+				curr[j] = d
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(t)]
+}
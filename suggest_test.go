@@ -0,0 +1,28 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTrieSuggest(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := New()
+	tr.Define("/api/users")
+	tr.Define("/api/users/:id")
+	tr.Define("/api/posts")
+	tr.Define("/api/teams")
+
+	assert.Nil(tr.Match("/api/usrs").Node)
+	assert.Equal([]string{"/api/users"}, tr.Suggest("/api/usrs", 1))
+	assert.Equal([]string{"/api/users", "/api/posts", "/api/teams"}, tr.Suggest("/api/usrs", 3))
+	assert.Equal(4, len(tr.Suggest("/x", 10)))
+	assert.Nil(tr.Suggest("/api/usrs", 0))
+
+	assert.Equal(0, levenshtein("", ""))
+	assert.Equal(3, levenshtein("abc", ""))
+	assert.Equal(1, levenshtein("汉字", "汉"))
+	assert.Equal(3, levenshtein("kitten", "sitting"))
+}
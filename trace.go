@@ -0,0 +1,126 @@
+package trie
+
+import "context"
+
+// TraceStep is a decision made by Trie.MatchTrace: a child node tried for a
+// path segment and whether it matched.
+type TraceStep struct {
+	// The path segment, it is folded when retried for Options.IgnoreCase.
+	Segment string
+	// The type of the tried child: "static", "param", "regex" or "wildcard".
+	Kind string
+	// The pattern of the tried child, or an empty string when none of the
+	// static children is keyed by the segment.
+	Pattern string
+	// Whether the child matched the segment.
+	Matched bool
+}
+
+// MatchTrace matches the path like Match and returns the children tried for every
+// segment in order, it can be used to find out why a path doesn't match or
+// matches an unexpected node. Only this method records the trace, Match is not
+// slowed down by it.
+//
+//  trie.Define("/foo")
+//  trie.Define("/:name")
+//  matched, steps := trie.MatchTrace("/Foo")
+//  // steps[0]: {"Foo", "static", "", false}
+//  // steps[1]: {"Foo", "param", "/:name", true}
+//
+func (t *Trie) MatchTrace(path string) (*Matched, []TraceStep) {
+	probe := &matchProbe{trace: true}
+	matched := t.matchPath(path, probe)
+	return matched, probe.steps
+}
+
+// matchProbe observes the matching of segments, it counts the regexp evaluations
+// into evals if it is not nil, records the tried children if trace is true, and
+// stops matching with the error of ctx if it is not nil and done.
+type matchProbe struct {
+	evals *int
+	trace bool
+	steps []TraceStep
+	ctx   context.Context
+	err   error
+}
+
+// matchNode is matchNode with the probe.
+func (p *matchProbe) matchNode(parent *Node, segment, rest string) *Node {
+	if p.ctx != nil {
+		if p.err = p.ctx.Err(); p.err != nil {
+			return nil
+		}
+	}
+	regexFirst := parent.trie.regexFirst && !parent.literal
+	if regexFirst {
+		for _, child := range parent.varyChildren {
+			if !child.regexParam() {
+				continue
+			}
+			ok := child.isEnabled() && child.matchVary(segment, rest, p.evals)
+			p.record(segment, child.kind(), child, ok)
+			if ok {
+				return child
+			}
+		}
+	}
+	child := parent.getChild(segment)
+	ok := child != nil && child.isEnabled()
+	if len(parent.children) > 0 {
+		p.record(segment, "static", child, ok)
+	}
+	if ok {
+		return child
+	}
+	if parent.literal {
+		return nil
+	}
+	for i := 0; i < len(parent.varyChildren); i++ {
+		child = parent.varyChildren[i]
+		if regexFirst && child.regexParam() {
+			continue
+		}
+		// the combined regexp of Optimize is evaluated once for the group
+		if group := child.regexGroup; group != nil {
+			found := group.match(segment, p.evals)
+			for _, node := range group.nodes {
+				p.record(segment, node.kind(), node, node == found)
+				if node == found {
+					return found
+				}
+			}
+			i += len(group.nodes) - 1
+			continue
+		}
+		ok = child.isEnabled() && child.matchVary(segment, rest, p.evals)
+		p.record(segment, child.kind(), child, ok)
+		if ok {
+			return child
+		}
+	}
+	return nil
+}
+
+func (p *matchProbe) record(segment, kind string, n *Node, ok bool) {
+	if !p.trace {
+		return
+	}
+	step := TraceStep{Segment: segment, Kind: kind, Matched: ok}
+	if n != nil {
+		step.Pattern = n.getSegments()
+	}
+	p.steps = append(p.steps, step)
+}
+
+// kind returns the type of the node for TraceStep.
+func (n *Node) kind() string {
+	switch {
+	case n.wildcard:
+		return "wildcard"
+	case n.regex != nil:
+		return "regex"
+	case n.name != "" || n.anonymous:
+		return "param"
+	}
+	return "static"
+}
@@ -0,0 +1,67 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTrieMatchTrace(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := New()
+	tr.Define("/foo")
+	name := tr.Define("/:name")
+	tr.Define("/:name/:id(^[0-9]+$)")
+	tr.Define("/:name/:sub/:path*")
+
+	// "/Foo" hits the param before the static route is retried with the folded segment
+	res, steps := tr.MatchTrace("/Foo")
+	EqualPtr(t, name, res.Node)
+	assert.Equal([]TraceStep{
+		{"Foo", "static", "", false},
+		{"Foo", "param", "/:name", true},
+	}, steps)
+
+	res, steps = tr.MatchTrace("/foo")
+	assert.Equal("/foo", res.Pattern)
+	assert.Equal([]TraceStep{{"foo", "static", "/foo", true}}, steps)
+
+	res, steps = tr.MatchTrace("/x/a/b/c")
+	assert.Equal("b/c", res.Params["path"])
+	assert.Equal([]TraceStep{
+		{"x", "static", "", false},
+		{"x", "param", "/:name", true},
+		{"a", "regex", "/:name/:id(^[0-9]+$)", false},
+		{"a", "param", "/:name/:sub", true},
+		{"b", "wildcard", "/:name/:sub/:path*", true},
+	}, steps)
+
+	// the trace doesn't change the result
+	assert.Equal(tr.Match("/x/1").Params, func() map[string]string {
+		res, _ := tr.MatchTrace("/x/1")
+		return res.Params
+	}())
+
+	tr = New(Options{IgnoreCase: true, TrackRegexEvals: true})
+	tr.Define("/foo/:id(^[0-9]+$)")
+	res, steps = tr.MatchTrace("/FOO/a")
+	assert.Nil(res.Node)
+	assert.Equal(2, res.RegexEvals)
+	assert.Equal([]TraceStep{
+		{"FOO", "static", "", false},
+		{"foo", "static", "/foo", true},
+		{"a", "regex", "/foo/:id(^[0-9]+$)", false},
+		{"a", "regex", "/foo/:id(^[0-9]+$)", false},
+	}, steps)
+
+	// static only tries are traced too
+	tr = New(Options{})
+	tr.Define("/a/b")
+	res, steps = tr.MatchTrace("/a/c")
+	assert.Nil(res.Node)
+	assert.Equal([]TraceStep{
+		{"a", "static", "/a", true},
+		{"c", "static", "", false},
+	}, steps)
+}
@@ -2,10 +2,18 @@
 package trie
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net/url"
+	"path/filepath"
 	"regexp"
+	"regexp/syntax"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // Version is trie-mux version
@@ -21,6 +29,9 @@ type Options struct {
 	// Matched.FPR will returns either a fixed redirect path or an empty string.
 	// For example when "/api/foo" defined and matching "/api//foo",
 	// The result Matched.FPR is "/api/foo".
+	// The "//" in the remainder of a catch-all is collapsed too, so a path like
+	// "/proxy/http://example.com" for "/proxy/:url*" is redirected instead of
+	// matching. Trie.Warnings reports the catch-all regexps that require "//".
 	FixedPathRedirect bool
 
 	// If enabled, the trie will detect if the current path can't be matched but
@@ -30,7 +41,102 @@ type Options struct {
 	// client is redirected to /foo
 	// For example when "/api/foo" defined and matching "/api/foo/",
 	// The result Matched.TSR is "/api/foo".
+	// It doesn't apply once a catch-all parameter matched the remainder, the
+	// trailing slash is captured, such as "a/b/" for "/files/a/b/" on "/files/:path*".
 	TrailingSlashRedirect bool
+
+	// Ignore case of method names when mounting and looking up handlers.
+	// Methods are stored in canonical uppercase, so Node.GetHandler("get")
+	// returns the handler mounted with "GET".
+	IgnoreMethodCase bool
+
+	// The maximum nesting depth of quantifiers (`*`, `+`, `?`, `{n,m}`) allowed
+	// in regexp parameters, zero means no limit, which is the default. Patterns
+	// like `:x((a+)+$)` are rejected on definition when it is 1. Go regexps run in
+	// linear time, so it is a style limit rather than a protection.
+	MaxRegexNesting int
+
+	// If enabled, the value captured by a catch-all parameter begins with the
+	// '/' before it. For example when "/proxy/:rest*" defined and matching
+	// "/proxy/foo/bar", Params["rest"] is "/foo/bar" instead of "foo/bar",
+	// and matching "/proxy/" captures "/" instead of "".
+	WildcardLeadingSlash bool
+
+	// If enabled, parameters can be defined without names, such as ":",
+	// ":(regexp)", ":+suffix" and ":*". Their values are captured into
+	// Matched.Positional in path order instead of Matched.Params.
+	// For example when "/:/comments/:id" defined and matching "/123/comments/456",
+	// Matched.Positional is []string{"123"} and Params["id"] is "456".
+	AnonymousParams bool
+
+	// The maximum number of parameters captured by a match, zero means no limit.
+	// A catch-all parameter counts as one. Match returns an empty Matched when
+	// a path captures more parameters than the limit.
+	MaxParams int
+
+	// If enabled, Match counts the regexp evaluations of parameter nodes into
+	// Matched.RegexEvals, it can be used to find expensive routes.
+	TrackRegexEvals bool
+
+	// The method names accepted by Trie.MatchRPC as the leading path segment.
+	// The standard HTTP methods are used if it is empty.
+	RPCMethods []string
+
+	// The function to fold the case of segments when IgnoreCase enabled,
+	// strings.ToLower is used if it is nil. For example strings.ToLowerSpecial
+	// for a specific locale, or a function that folds only ASCII letters.
+	CaseFold func(string) string
+
+	// The flags prepended to the regexp of parameters, such as "i" for case-insensitive
+	// or "s" to let `.` match "\n". Inline flags in a regexp take precedence,
+	// for example "(?-i)" in it turns off the "i" flag for the rest of the regexp.
+	// Note that when IgnoreCase enabled, a segment not matched is retried in folded
+	// case, so lowercase regexps like `[a-z]+` match "ABC" even without the "i" flag.
+	RegexFlags string
+
+	// The regexp to validate parameter names, `^\w+$` is used if it is nil.
+	// For example `^[\w.-]+$` allows names like ":user-id" and ":file.ext".
+	// The catch-all marker "*", the regexp "(...)" and the suffix "+..." are
+	// parsed from the parameter before the name is validated.
+	ParamNameRegex *regexp.Regexp
+
+	// The pattern of leading segments that Match peels off before routing, such
+	// as "/t/:tenant". Its params are saved on Matched.Params, and the rest of
+	// the path is matched against the trie. A path that doesn't match the prefix
+	// doesn't match any route. For example when TenantPrefix is "/t/:tenant" and
+	// "/users/:id" defined, matching "/t/acme/users/1" results in
+	// Params{"tenant": "acme", "id": "1"}. Only Match and the methods based on it
+	// apply the prefix.
+	TenantPrefix string
+
+	// The separator of composite method keys, such as "GET+json" and "GET+xml"
+	// for content negotiation, "+" is used if it is empty. Node.GetAllow and
+	// Node.GetMethods list the base method "GET" once, and Node.GetVariants("GET")
+	// returns the variants "json" and "xml".
+	VariantSeparator string
+
+	// If enabled, the hex digits of percent-encoded sequences in the path are
+	// uppercased before matching, such as "%2f" to "%2F", as RFC 3986 recommends.
+	// Like FixedPathRedirect, Matched.FPR is the normalized path and Matched.Node
+	// is nil when the path was changed. A "%" not followed by two hex digits is
+	// kept as is.
+	NormalizePercentEncoding bool
+
+	// If enabled, the regexp parameter children of a node are tried before its
+	// static children, otherwise a static child takes precedence by default. For
+	// example with "/users/me" and "/users/:id(^[a-z]+$)" defined, "/users/me"
+	// matches ":id" when enabled, so a regexp can override specific values of the
+	// static routes. Catch-all and plain parameters are still tried after the
+	// static children, and as Match doesn't backtrack, a static subtree is not
+	// reached for a segment that a regexp matches.
+	RegexFirst bool
+
+	// If enabled, a parameter doesn't match an empty segment unless it is optional,
+	// such as ":name?", or catch-all. For example when "/x/:y" defined and
+	// FixedPathRedirect disabled, "/x/" matches with Params["y"] "" by default,
+	// and it doesn't match when enabled, so TrailingSlashRedirect can apply.
+	// BuildPath also rejects an empty value for such a parameter.
+	StrictEmptyParams bool
 }
 
 // the valid characters for the path component:
@@ -42,6 +148,8 @@ var (
 	wordReg        = regexp.MustCompile(`^\w+$`)
 	suffixReg      = regexp.MustCompile(`\+[A-Za-z0-9!$%&'*+,-.:;=@_~]*$`)
 	doubleColonReg = regexp.MustCompile(`^::[A-Za-z0-9!$%&'*+,-.:;=@_~]*$`)
+	bracketedReg   = regexp.MustCompile(`^\[.*\]$`)
+	httpMethods    = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE"}
 	defaultOptions = Options{
 		IgnoreCase:            true,
 		TrailingSlashRedirect: true,
@@ -61,24 +169,159 @@ func New(args ...Options) *Trie {
 		opts = args[0]
 	}
 
-	return &Trie{
-		ignoreCase: opts.IgnoreCase,
-		fpr:        opts.FixedPathRedirect,
-		tsr:        opts.TrailingSlashRedirect,
-		root: &Node{
-			parent:   nil,
-			children: make(map[string]*Node),
-			handlers: make(map[string]interface{}),
-		},
+	t := &Trie{
+		options:          opts,
+		ignoreCase:       opts.IgnoreCase,
+		ignoreMethodCase: opts.IgnoreMethodCase,
+		fpr:              opts.FixedPathRedirect,
+		tsr:              opts.TrailingSlashRedirect,
+		maxRegexNesting:  opts.MaxRegexNesting,
+		wildcardSlash:    opts.WildcardLeadingSlash,
+		anonymousParams:  opts.AnonymousParams,
+		maxParams:        opts.MaxParams,
+		trackRegexEvals:  opts.TrackRegexEvals,
+		staticOnly:       true,
+		rpcMethods:       make(map[string]bool),
+		caseFold:         opts.CaseFold,
+		regexFlags:       opts.RegexFlags,
+		paramNameReg:     opts.ParamNameRegex,
+		variantSep:       opts.VariantSeparator,
+		normalizePercent: opts.NormalizePercentEncoding,
+		regexFirst:       opts.RegexFirst,
+		strictEmpty:      opts.StrictEmptyParams,
+	}
+	if t.caseFold == nil {
+		t.caseFold = strings.ToLower
 	}
+	if t.paramNameReg == nil {
+		t.paramNameReg = wordReg
+	}
+	if t.variantSep == "" {
+		t.variantSep = "+"
+	}
+	if opts.TenantPrefix != "" {
+		t.tenant = New(Options{
+			IgnoreCase:     opts.IgnoreCase,
+			RegexFlags:     opts.RegexFlags,
+			ParamNameRegex: opts.ParamNameRegex,
+			CaseFold:       opts.CaseFold,
+		})
+		t.tenant.define(t.tenant.root, opts.TenantPrefix, 0)
+		t.tenantSegments = len(splitPattern(strings.TrimPrefix(opts.TenantPrefix, "/")))
+	}
+	methods := opts.RPCMethods
+	if len(methods) == 0 {
+		methods = httpMethods
+	}
+	for _, method := range methods {
+		t.rpcMethods[t.normalizeMethod(method)] = true
+	}
+	t.root = &Node{
+		trie:     t,
+		parent:   nil,
+		children: make(map[string]*Node),
+	}
+	return t
 }
 
 // Trie represents a trie that defining patterns and matching URL.
 type Trie struct {
-	ignoreCase bool
-	fpr        bool
-	tsr        bool
-	root       *Node
+	options          Options
+	ignoreCase       bool
+	ignoreMethodCase bool
+	fpr              bool
+	tsr              bool
+	maxRegexNesting  int
+	wildcardSlash    bool
+	anonymousParams  bool
+	maxParams        int
+	trackRegexEvals  bool
+	staticOnly       bool // no vary nodes defined, Match can use matchStatic
+	rpcMethods       map[string]bool
+	caseFold         func(string) string
+	caseCollisions   [][2]string
+	regexFlags       string
+	paramNameReg     *regexp.Regexp
+	variantSep       string
+	normalizePercent bool
+	regexFirst       bool
+	strictEmpty      bool
+	frozen           bool
+	compressed       int32 // static chains are built, see compressChains
+	compressMu       sync.Mutex
+	onDefine         []func(string, *Node)
+	onMiss           []func(string, int)
+	lastID           int
+	handled          int64 // updated atomically, as handlers can be replaced concurrently
+	middleware       []interface{}
+	warnings         []string
+	tenant           *Trie
+	tenantSegments   int
+	definingFile     string
+	definingLine     int
+	root             *Node
+	notFound         interface{}
+	methodNotAllowed interface{}
+}
+
+// Options returns the options the trie was created with, such as the default
+// options for New() without arguments.
+//
+//  New(Options{IgnoreCase: true}).Options().IgnoreCase // true
+//
+func (t *Trie) Options() Options {
+	opts := t.options
+	opts.RPCMethods = append([]string(nil), opts.RPCMethods...)
+	return opts
+}
+
+// Len returns the number of endpoint nodes with at least one handler.
+//
+//  trie.Route("GET", "/a", handler)
+//  trie.Define("/b")
+//  trie.Len() // 1
+//
+func (t *Trie) Len() int {
+	return int(atomic.LoadInt64(&t.handled))
+}
+
+// Freeze freezes the trie against further modification, after that the methods
+// that modify the trie or its nodes panic with ErrFrozen, such as Define, Route,
+// Node.Handle and Node.Remove, and the methods returning errors such as LoadFrom
+// and Merge return it. Matching is still allowed.
+//
+//  trie.Freeze()
+//  trie.Define("/late") // panics: trie is frozen
+//
+func (t *Trie) Freeze() {
+	t.frozen = true
+	t.compressChains()
+}
+
+// Frozen returns true if the trie is frozen by Freeze.
+func (t *Trie) Frozen() bool {
+	return t.frozen
+}
+
+// Warnings returns the warnings recorded when defining patterns, for patterns
+// that are valid but may not match as expected. For example a regexp parameter
+// like ":path(.*/.*)" never matches, because it is matched against a single
+// segment without "/". And when FixedPathRedirect enabled, a catch-all regexp
+// that requires "//", like ":url*(https?:/{2}.+)", never matches, because Match
+// collapses "//" in the path first.
+func (t *Trie) Warnings() []string {
+	return t.warnings
+}
+
+// Use appends global middleware to the trie, it runs before the middleware of
+// any node, see Node.Middleware. The trie doesn't call middleware itself, their
+// types are up to the caller.
+//
+//  trie.Use(logger, recovery)
+//
+func (t *Trie) Use(mw ...interface{}) {
+	t.checkFrozen()
+	t.middleware = append(t.middleware, mw...)
 }
 
 // Define define a pattern on the trie and returns the endpoint node for the pattern.
@@ -96,333 +339,2302 @@ type Trie struct {
 // |--------|------|
 // | `:name` | named parameter |
 // | `:name*` | named with catch-all parameter |
+// | `:name+` | named with non-empty catch-all parameter, it doesn't match an empty remainder |
 // | `:name(regexp)` | named with regexp parameter |
+// | `:name*(regexp)` | named with catch-all parameter, the regexp matches the whole remainder |
+// | `:name.:format` | named parameter with extension parameter, split at the last "." |
+// | `:name?` | optional parameter, it can match an empty segment, such as "/a//b" for "/a/:name?/b" |
+// | `:name(regexp)?` | optional with regexp parameter, the regexp is not checked for an empty segment |
 // | `::name` | not named parameter, it is literal `:name` |
+// | `[...]` | bracketed segment, it is literal as is, such as `[::1]` |
+// | `\(name\)` | escaped segment, it is literal `(name)` without the escaping backslashes |
+// | `*` | glob, an anonymous parameter that matches a single segment |
+// | `**` | glob, an anonymous catch-all parameter |
+//
+// The values of the glob segments are captured into Matched.Positional, even if
+// Options.AnonymousParams is not enabled.
+//
+// A parameter matches an empty segment, such as "/a/" for "/a/:name", and with
+// Options.StrictEmptyParams it doesn't unless it is optional or catch-all.
+// When FixedPathRedirect enabled, "//" in the path is collapsed before matching,
+// so "/a//b" is redirected to "/a/b" and an optional parameter only matches an
+// empty last segment, such as "/a/" for "/a/:name?".
+//
+// The leading "/" of the pattern is optional, "users/:id" is the same as
+// "/users/:id", and the pattern of the endpoint node is always the "/" prefixed form.
 //
 func (t *Trie) Define(pattern string) *Node {
+	return t.define(t.root, pattern, 2)
+}
+
+// define defines the pattern beneath the parent and records the caller skip frames
+// above it as the location of the new nodes, the location is not recorded if skip is 0.
+func (t *Trie) define(parent *Node, pattern string, skip int) *Node {
+	t.checkFrozen()
 	if strings.Contains(pattern, "//") {
-		panic(fmt.Errorf(`multi-slash exist: "%s"`, pattern))
+		panic(newError(ErrMultiSlash, `multi-slash exist: "%s"`, pattern))
+	}
+	if parent.wildcard {
+		panic(newError(ErrWildcardContinuation, `can't define pattern after wildcard: "%s"`, parent.getSegments()))
+	}
+
+	if skip > 0 {
+		_, t.definingFile, t.definingLine, _ = runtime.Caller(skip)
+		defer func() { t.definingFile, t.definingLine = "", 0 }()
 	}
 
 	_pattern := strings.TrimPrefix(pattern, "/")
-	node := defineNode(t.root, strings.Split(_pattern, "/"), t.ignoreCase)
+	node := defineNode(parent, splitPattern(_pattern), t.ignoreCase)
 
+	if parent != t.root {
+		pattern = parent.getSegments() + "/" + _pattern
+	} else {
+		pattern = "/" + _pattern
+	}
 	if node.pattern == "" {
 		node.pattern = pattern
 	}
+	for _, fn := range t.onDefine {
+		fn(pattern, node)
+	}
 	return node
 }
 
-// Match try to match path. It will returns a Matched instance that
-// includes	*Node, Params and Tsr flag when matching success, otherwise a nil.
+// OnDefine registers a hook that is called at the end of every successful Define
+// with the pattern and the endpoint node, including the Define calls made by
+// Route, Node.Define, LoadFrom and DefineTree. The pattern of Node.Define is
+// joined with the node's pattern. Hooks are called in the order they were registered.
 //
-//  matched := trie.Match("/a/b")
+//  trie.OnDefine(func(pattern string, node *Node) {
+//  	registry = append(registry, pattern)
+//  })
 //
-func (t *Trie) Match(path string) *Matched {
-	if path == "" || path[0] != '/' {
-		panic(fmt.Errorf(`path is not start with "/": "%s"`, path))
-	}
-	fixedLen := len(path)
-	if t.fpr {
-		path = fixPath(path)
-		fixedLen -= len(path)
+func (t *Trie) OnDefine(fn func(pattern string, n *Node)) {
+	t.onDefine = append(t.onDefine, fn)
+}
+
+// OnMiss registers a hook that is called by Match when the path matches neither
+// an endpoint nor a redirect, with the path as it was given and the number of
+// segments matched before it failed, see Matched.MatchedDepth. It can be used to
+// find the most missed paths. Hooks are called in the order they were registered.
+//
+//  trie.Define("/api/users/:id")
+//  trie.OnMiss(func(path string, depth int) {
+//  	log.Printf("miss %s at depth %d", path, depth) // "miss /api/posts/1 at depth 1"
+//  })
+//  trie.Match("/api/posts/1")
+//
+func (t *Trie) OnMiss(fn func(path string, depth int)) {
+	t.checkFrozen()
+	t.onMiss = append(t.onMiss, fn)
+}
+
+// MatchQuery matches the path like Match, and then checks the query constraints
+// registered by Node.RequireQuery on the matched node. Matched.Node is nil if any
+// constraint is not satisfied, then the OnMiss hooks are called instead of the
+// OnMatch hooks of the node.
+//
+//  trie.Define("/search").RequireQuery("type", "^image$")
+//  trie.MatchQuery("/search", url.Values{"type": {"image"}}).Node // not nil
+//  trie.MatchQuery("/search", url.Values{"type": {"video"}}).Node // nil
+//
+func (t *Trie) MatchQuery(path string, query url.Values) *Matched {
+	matched := t.matchRoute(path, nil)
+	if matched.Node != nil && !matched.Node.matchQuery(query) {
+		matched.Node = nil
+		matched.Pattern = ""
 	}
+	t.runHooks(path, matched, nil)
+	return matched
+}
 
-	start := 1
-	end := len(path)
+// Route defines the pattern and mounts the handler with the method to the
+// endpoint node, then returns the node.
+//
+//  trie := New()
+//  trie.Route("GET", "/users/:id", handler1)
+//  trie.Route("PUT", "/users/:id", handler2)
+//  // trie.Match("/users/123").Node.GetAllow() == "GET, PUT"
+//
+func (t *Trie) Route(method, pattern string, handler interface{}) *Node {
+	node := t.define(t.root, pattern, 2)
+	node.Handle(method, handler)
+	return node
+}
+
+// MatchSegments matches the path that is already split into segments, such as
+// []string{"a", "b"} for "/a/b", without scanning the path bytes. The value of
+// a catch-all parameter is the remaining segments joined with "/".
+// There is no raw path in this mode, so FixedPathRedirect and
+// TrailingSlashRedirect are disabled, Matched.FPR and Matched.TSR are always empty.
+//
+//  matched := trie.MatchSegments([]string{"a", "b"})
+//
+func (t *Trie) MatchSegments(segments []string) *Matched {
 	matched := new(Matched)
 	parent := t.root
-	for i := 1; i <= end; i++ {
-		if i < end && path[i] != '/' {
-			continue
-		}
-		segment := path[start:i]
-		node := matchNode(parent, segment)
-		if t.ignoreCase && node == nil {
-			node = matchNode(parent, strings.ToLower(segment))
+	for i, segment := range segments {
+		rest := ""
+		if parent.hasWildcard() {
+			rest = strings.Join(segments[i:], "/")
+			if t.wildcardSlash {
+				rest = "/" + rest
+			}
 		}
+		node := t.matchSegment(parent, segment, rest, nil)
 		if node == nil {
-			// TrailingSlashRedirect: /abc/efg/ -> /abc/efg
-			if t.tsr && parent.endpoint && i == end && segment == "" {
-				matched.TSR = path[:end-1]
-				if t.fpr && fixedLen > 0 {
-					matched.FPR = matched.TSR
-					matched.TSR = ""
-				}
-			}
 			return matched
 		}
 
 		parent = node
-		if parent.name != "" {
-			if matched.Params == nil {
-				matched.Params = make(map[string]string)
+		matched.MatchedDepth++
+		matched.LastNode = node
+		if parent.name != "" || parent.anonymous {
+			value := segment
+			if parent.wildcard {
+				value = rest
+			} else if parent.suffix != "" {
+				value = segment[0 : len(segment)-len(parent.suffix)]
+			}
+
+			matched.capture(parent, value)
+			if t.maxParams > 0 && len(matched.Params)+len(matched.Positional) > t.maxParams {
+				return new(Matched)
 			}
 			if parent.wildcard {
-				matched.Params[parent.name] = path[start:end]
 				break
-			} else {
-				if parent.suffix != "" {
-					segment = segment[0 : len(segment)-len(parent.suffix)]
-				}
-				matched.Params[parent.name] = segment
 			}
 		}
-		start = i + 1
 	}
 
-	switch {
-	case parent.endpoint:
-		matched.Node = parent
-		if t.fpr && fixedLen > 0 {
-			matched.FPR = path
-			matched.Node = nil
-		}
-	case t.tsr && parent.getChild("") != nil:
-		// TrailingSlashRedirect: /abc/efg -> /abc/efg/
-		matched.TSR = path + "/"
-		if t.fpr && fixedLen > 0 {
-			matched.FPR = matched.TSR
-			matched.TSR = ""
-		}
+	if target := parent.resolve(); parent.endpoint && target.satisfies(matched.Params) {
+		matched.Node = target
+		matched.Pattern = target.pattern
 	}
-
 	return matched
 }
 
-// Matched is a result returned by Trie.Match.
-type Matched struct {
-	// Either a Node pointer when matched or nil
-	Node *Node
-
-	// Either a map contained matched values or empty map.
-	Params map[string]string
-
-	// If FixedPathRedirect enabled, it may returns a redirect path,
-	// otherwise a empty string.
-	FPR string
+// Has returns true if an endpoint node for the pattern is already defined. It
+// doesn't modify the trie. Parameter fragments are compared structurally, so
+// "/a/:id" is not defined by "/a/:other", while "/a/:id(^\d+$)" is only defined
+// by the same regexp.
+//
+//  trie.Define("/a/:id")
+//  trie.Has("/a/:id")    // true
+//  trie.Has("/a/:other") // false
+//
+func (t *Trie) Has(pattern string) bool {
+	node := t.findNode(pattern)
+	return node != nil && node.endpoint
+}
 
-	// If TrailingSlashRedirect enabled, it may returns a redirect path,
-	// otherwise a empty string.
-	TSR string
+// Alias defines the alias pattern to resolve to the endpoint node of the existing
+// pattern, so Match returns the existing node with its pattern, handlers and hooks
+// for a path of either pattern, and later changes of the node are reflected
+// through the alias. The alias must capture the same params in the same order.
+// Walk reports both patterns. Aliases are not kept by Snapshot and Merge.
+//
+//  trie.Define("/users/:id").Handle("GET", getUser)
+//  trie.Alias("/users/:id", "/u/:id")
+//  trie.Match("/u/42").Node.GetHandler("GET") // getUser
+//
+// It returns an error wrapping ErrNotDefined if the existing pattern is not
+// defined, or ErrPatternConflict if the alias is already handled or its params differ.
+func (t *Trie) Alias(existing, alias string) error {
+	t.checkFrozen()
+	node := t.findNode(existing)
+	if node == nil || !node.endpoint {
+		return newError(ErrNotDefined, `"%s" is not defined`, existing)
+	}
+	node = node.resolve()
+	if prev := t.findNode(alias); prev != nil && prev.endpoint {
+		if prev == node || prev.aliasOf == node {
+			return newError(ErrPatternConflict, `alias "%s" is already "%s"`, alias, node.pattern)
+		}
+		if prev.HasHandlers() || prev.aliasOf != nil {
+			return newError(ErrPatternConflict, `alias "%s" is already handled`, alias)
+		}
+	}
+	// parse the alias on a scratch trie to compare the params before defining it
+	names := New(t.Options()).Define(alias).paramNames()
+	if strings.Join(names, ",") != strings.Join(node.paramNames(), ",") {
+		return newError(ErrPatternConflict, `alias "%s" params %v differ from "%s"`, alias, names, node.pattern)
+	}
+	t.define(t.root, alias, 2).aliasOf = node
+	return nil
 }
 
-// Node represents a node on defined patterns that can be matched.
-type Node struct {
-	name, allow, pattern, segment, suffix string
-	endpoint, wildcard                    bool
-	parent                                *Node
-	varyChildren                          []*Node
-	children                              map[string]*Node
-	handlers                              map[string]interface{}
-	regex                                 *regexp.Regexp
+// resolve returns the node that the alias node resolves to, or the node itself.
+func (n *Node) resolve() *Node {
+	if n.aliasOf != nil {
+		return n.aliasOf
+	}
+	return n
 }
 
-func (n *Node) getSegments() string {
-	segments := n.segment
-	if n.parent != nil {
-		segments = n.parent.getSegments() + "/" + segments
+// paramNames returns the names of the params captured on the path to the node in order.
+func (n *Node) paramNames() []string {
+	var names []string
+	for node := n; node.parent != nil; node = node.parent {
+		if node.format != "" {
+			names = append(names, node.format)
+		}
+		if node.name != "" {
+			names = append(names, node.name)
+		}
 	}
-	return segments
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return names
 }
 
-func (n *Node) getChild(key string) *Node {
-	return n.children[key]
+// findNode returns the node defined for the pattern, or nil.
+func (t *Trie) findNode(pattern string) *Node {
+	if strings.Contains(pattern, "//") {
+		return nil
+	}
+
+	parent := t.root
+	for _, segment := range splitPattern(strings.TrimPrefix(pattern, "/")) {
+		if !parent.literal && (segment == "*" || segment == "**" ||
+			segment != "" && segment[0] == ':' && !doubleColonReg.MatchString(segment)) {
+			node := &Node{segment: segment, trie: t, parent: parent}
+			node.parseParam()
+			if parent = findVaryChild(parent, node); parent == nil {
+				return nil
+			}
+			continue
+		}
+
+		segment = staticKey(parent, segment)
+		if t.ignoreCase {
+			segment = t.caseFold(segment)
+		}
+		if parent = parent.getChild(segment); parent == nil {
+			return nil
+		}
+	}
+	return parent
 }
 
-// Handle is used to mount a handler with a method name to the node.
+// RemoveSubtree detaches the node defined for the prefix pattern and all its
+// descendants from the trie, and returns the number of endpoint nodes removed.
+// The aliases of the removed endpoints are dropped and counted as removed too.
+// The prefix is looked up like Has, parameter fragments are compared structurally.
+// It returns 0 if the prefix is not defined.
 //
-//  t := New()
-//  node := t.Define("/a/b")
-//  node.Handle("GET", handler1)
-//  node.Handle("POST", handler1)
+//  trie.Define("/plugin/a")
+//  trie.Define("/plugin/:id/b")
+//  trie.RemoveSubtree("/plugin") // 2
 //
-func (n *Node) Handle(method string, handler interface{}) {
-	if n.GetHandler(method) != nil {
-		panic(fmt.Errorf(`"%s" already defined`, n.getSegments()))
+func (t *Trie) RemoveSubtree(prefix string) int {
+	t.checkFrozen()
+	node := t.findNode(prefix)
+	if node == nil {
+		return 0
 	}
-	n.handlers[method] = handler
-	if n.allow == "" {
-		n.allow = method
-	} else {
-		n.allow += ", " + method
+
+	parent := node.parent
+	if parent.children[node.key] == node {
+		delete(parent.children, node.key)
+	}
+	for i, child := range parent.varyChildren {
+		if child == node {
+			parent.varyChildren = append(parent.varyChildren[:i:i], parent.varyChildren[i+1:]...)
+			break
+		}
+	}
+
+	count := 0
+	detached := map[*Node]bool{}
+	removed := func(n *Node) {
+		detached[n] = true
+		if n.endpoint {
+			count++
+		}
+		if n.HasHandlers() {
+			atomic.AddInt64(&t.handled, -1)
+		}
 	}
+	removed(node)
+	walkNode(node, func(_ string, n *Node) bool {
+		removed(n)
+		return true
+	})
+	// the aliases of removed nodes are dropped, they are left for Compact
+	walkNode(t.root, func(_ string, n *Node) bool {
+		if n.aliasOf != nil && detached[n.aliasOf] {
+			n.aliasOf = nil
+			n.endpoint = false
+			n.pattern = ""
+			count++
+		}
+		return true
+	})
+	return count
 }
 
-// GetHandler ...
-// GetHandler returns handler by method that defined on the node
-//
-//  trie := New()
-//  trie.Define("/api").Handle("GET", func handler1() {})
-//  trie.Define("/api").Handle("PUT", func handler2() {})
+// Compact removes the nodes that are left without a purpose, such as "/a" after
+// RemoveSubtree("/a/b") when "/a" is not defined itself, and returns the number of
+// removed nodes. A node is removed if it is not an endpoint and has no children,
+// handlers, subtree handlers, middleware, not found handler or delegate. Nodes are
+// keyed by whole segments, so a node with a single child is not merged with it.
+// The nodes of the aliases dropped by RemoveSubtree are removed the same way.
 //
-//  trie.Match("/api").Node.GetHandler("GET").(func()) == handler1
-//  trie.Match("/api").Node.GetHandler("PUT").(func()) == handler2
+//  trie.Define("/a/b")
+//  trie.RemoveSubtree("/a/b")
+//  trie.Compact() // 1
 //
-func (n *Node) GetHandler(method string) interface{} {
-	return n.handlers[method]
+func (t *Trie) Compact() int {
+	t.checkFrozen()
+	return compactNode(t.root)
+}
+
+func compactNode(parent *Node) int {
+	count := 0
+	for key, child := range parent.children {
+		count += compactNode(child)
+		if child.removable() {
+			delete(parent.children, key)
+			count++
+		}
+	}
+	var varyChildren []*Node
+	for _, child := range parent.varyChildren {
+		count += compactNode(child)
+		if child.removable() {
+			count++
+			continue
+		}
+		varyChildren = append(varyChildren, child)
+	}
+	parent.varyChildren = varyChildren
+	return count
 }
 
-// GetAllow returns allow methods defined on the node
+// removable returns true if the node can be removed by Compact.
+func (n *Node) removable() bool {
+	return !n.endpoint && len(n.children) == 0 && len(n.varyChildren) == 0 && !n.HasHandlers() &&
+		len(n.subtreeHandlers) == 0 && len(n.middleware) == 0 && n.notFound == nil && n.delegate == nil
+}
+
+// Match try to match path. It will returns a Matched instance that
+// includes	*Node, Params and Tsr flag when matching success, otherwise a nil.
 //
-//  trie := New()
-//  trie.Define("/").Handle("GET", handler1)
-//  trie.Define("/").Handle("PUT", handler2)
+//  matched := trie.Match("/a/b")
 //
-//  // trie.Match("/").Node.GetAllow() == "GET, PUT"
+// A defined endpoint always takes precedence over redirects: Matched.TSR and
+// Matched.FPR are empty when Matched.Node is not nil. So when both "/foo" and
+// "/foo/" are defined, each of them matches itself. The only case a defined
+// endpoint is not returned is when FixedPathRedirect enabled and the path was
+// fixed, such as "/foo//" for "/foo/", then Matched.Node is nil and Matched.FPR
+// is the fixed path.
 //
-func (n *Node) GetAllow() string {
-	return n.allow
+func (t *Trie) Match(path string) *Matched {
+	return t.matchPath(path, nil)
 }
 
-// GetPattern returns pattern defined on the node
-func (n *Node) GetPattern() string {
-	return n.pattern
+// matchPath matches the path with the probe, and then runs the hooks.
+func (t *Trie) matchPath(path string, probe *matchProbe) *Matched {
+	matched := t.matchRoute(path, probe)
+	t.runHooks(path, matched, probe)
+	return matched
 }
 
-func defineNode(parent *Node, segments []string, ignoreCase bool) *Node {
-	segment := segments[0]
-	segments = segments[1:]
-	child := parseNode(parent, segment, ignoreCase)
-
-	if len(segments) == 0 {
-		child.endpoint = true
-		return child
+// matchRoute checks and fixes the path, and then matches it with the probe.
+func (t *Trie) matchRoute(path string, probe *matchProbe) *Matched {
+	if path == "" || path[0] != '/' {
+		panic(newError(ErrPathNotSlash, `path is not start with "/": "%s"`, path))
 	}
-	if child.wildcard {
-		panic(fmt.Errorf(`can't define pattern after wildcard: "%s"`, child.getSegments()))
+	fixed := false
+	if t.fpr {
+		fixedPath := fixPath(path)
+		fixed = len(fixedPath) != len(path)
+		path = fixedPath
+	}
+	if t.normalizePercent {
+		normalized := normalizePercent(path)
+		fixed = fixed || normalized != path
+		path = normalized
 	}
-	return defineNode(child, segments, ignoreCase)
-}
 
-func matchNode(parent *Node, segment string) (child *Node) {
-	if child = parent.getChild(segment); child != nil {
-		return
+	var matched *Matched
+	if t.tenant != nil {
+		matched = t.matchTenant(path, fixed, probe)
+	} else {
+		matched = t.match(path, fixed, probe)
 	}
-	for _, child = range parent.varyChildren {
-		_segment := segment
-		if child.suffix != "" {
-			if segment == child.suffix || !strings.HasSuffix(segment, child.suffix) {
-				continue
-			}
-			_segment = segment[0 : len(segment)-len(child.suffix)]
+	return matched
+}
+
+// runHooks runs the OnMatch hooks of the matched node, or the OnMiss hooks with
+// the path as it was given if nothing matched.
+func (t *Trie) runHooks(path string, matched *Matched, probe *matchProbe) {
+	// the node of a delegated match runs its hooks in its own trie
+	if node := matched.Node; node != nil && node.trie == t {
+		for _, fn := range node.onMatch {
+			fn(matched.Params)
 		}
-		if child.regex != nil && !child.regex.MatchString(_segment) {
-			continue
+	} else if node == nil && matched.TSR == "" && matched.FPR == "" && (probe == nil || probe.err == nil) {
+		for _, fn := range t.onMiss {
+			fn(path, matched.MatchedDepth)
 		}
-		return
 	}
-	return nil
 }
 
-func parseNode(parent *Node, segment string, ignoreCase bool) *Node {
-	_segment := segment
-	if doubleColonReg.MatchString(segment) {
-		_segment = segment[1:]
+// matchTenant matches the tenant prefix of the path defined by Options.TenantPrefix,
+// and then matches the rest of the path.
+func (t *Trie) matchTenant(path string, fixed bool, probe *matchProbe) *Matched {
+	prefix, rest := path, "/"
+	index := 0
+	for i := 0; i <= t.tenantSegments; i++ {
+		next := strings.IndexByte(path[index+1:], '/')
+		if next < 0 {
+			break
+		}
+		index += next + 1
+		if i == t.tenantSegments-1 {
+			prefix, rest = path[:index], path[index:]
+			break
+		}
 	}
-	if ignoreCase {
-		_segment = strings.ToLower(_segment)
+
+	tenant := t.tenant.Match(prefix)
+	if tenant.Node == nil {
+		return new(Matched)
 	}
-	if node := parent.getChild(_segment); node != nil {
-		return node
+	matched := t.match(rest, fixed, probe)
+	matched.MatchedDepth += tenant.MatchedDepth
+	if matched.TSR != "" {
+		matched.TSR = prefix + matched.TSR
 	}
-
-	node := &Node{
-		segment:  segment,
-		parent:   parent,
-		children: make(map[string]*Node),
-		handlers: make(map[string]interface{}),
+	if matched.FPR != "" {
+		matched.FPR = prefix + matched.FPR
 	}
+	if len(tenant.ordered) > 0 {
+		if matched.Params == nil {
+			matched.Params = make(map[string]string)
+		}
+		for _, param := range tenant.ordered {
+			matched.Params[param.Name] = param.Value
+		}
+		matched.ordered = append(tenant.ordered, matched.ordered...)
+	}
+	return matched
+}
 
-	switch {
-	case segment == "":
-		parent.children[segment] = node
-
-	case doubleColonReg.MatchString(segment):
-		// pattern "/a/::" should match "/a/:"
-		// pattern "/a/::bc" should match "/a/:bc"
-		// pattern "/a/::/bc" should match "/a/:/bc"
-		parent.children[_segment] = node
-
-	case segment[0] == ':':
-		name := segment[1:]
-
-		switch name[len(name)-1] {
-		case '*':
-			name = name[0 : len(name)-1]
-			node.wildcard = true
+// match matches the path that was checked and fixed by Match, the probe is nil
+// if neither counting regexp evaluations nor tracing.
+func (t *Trie) match(path string, fixed bool, probe *matchProbe) *Matched {
+	if probe == nil {
+		t.compressChains()
+	}
+	if t.staticOnly && probe == nil {
+		return t.matchStatic(path, fixed)
+	}
 
-		default:
-			var suffix = suffixReg.FindString(name)
-			if suffix != "" {
-				name = name[0 : len(name)-len(suffix)]
-				node.suffix = suffix[1:]
-				if node.suffix == "" {
-					panic(fmt.Errorf(`invalid pattern: "%s"`, node.getSegments()))
+	start := 1
+	end := len(path)
+	matched := new(Matched)
+	parent := t.root
+	delegate, delegateAt := t.root, 0
+	if t.trackRegexEvals {
+		if probe == nil {
+			probe = new(matchProbe)
+		}
+		probe.evals = &matched.RegexEvals
+	}
+	for i := 1; i <= end; i++ {
+		// the probe traces every node, it doesn't skip the static chains
+		if chain := parent.chain; i == start && chain != nil && probe == nil {
+			if n := chain.skip(path[start:end]); n > 0 {
+				parent = chain.end
+				matched.MatchedDepth += chain.depth
+				matched.LastNode = parent
+				i = start + n
+				if parent.delegate != nil {
+					delegate, delegateAt = parent, i
 				}
+				start = i + 1
+				continue
 			}
+		}
+		if i < end && path[i] != '/' {
+			continue
+		}
+		segment := path[start:i]
+		rest := path[start:end]
+		if t.wildcardSlash {
+			rest = path[start-1 : end]
+		}
+		node := t.matchSegment(parent, segment, rest, probe)
+		if node == nil {
+			if delegate.delegate != nil {
+				if m := delegate.delegate(path[delegateAt:]); m != nil {
+					return m
+				}
+			}
+			// TrailingSlashRedirect: /abc/efg/ -> /abc/efg
+			if t.tsr && parent.endpoint && !parent.exact && i == end && segment == "" {
+				t.redirect(matched, path[:end-1], fixed)
+			}
+			return matched
+		}
+
+		parent = node
+		matched.MatchedDepth++
+		matched.LastNode = node
+		if node.delegate != nil {
+			delegate, delegateAt = node, i
+		}
+		if parent.name != "" || parent.anonymous {
+			value := segment
+			if parent.wildcard {
+				value = rest
+			} else if parent.suffix != "" {
+				value = segment[0 : len(segment)-len(parent.suffix)]
+			}
+
+			matched.capture(parent, value)
+			if t.maxParams > 0 && len(matched.Params)+len(matched.Positional) > t.maxParams {
+				return new(Matched)
+			}
+			if parent.wildcard {
+				break
+			}
+		}
+		start = i + 1
+	}
+
+	if !parent.endpoint && delegate.delegate != nil {
+		if m := delegate.delegate(path[delegateAt:]); m != nil {
+			return m
+		}
+	}
+	t.matchEndpoint(matched, parent, path, fixed)
+	return matched
+}
+
+// matchStatic is the fast path of Match for a trie without vary nodes, it walks
+// the static children only.
+func (t *Trie) matchStatic(path string, fixed bool) *Matched {
+	start := 1
+	end := len(path)
+	matched := new(Matched)
+	parent := t.root
+	for i := 1; i <= end; i++ {
+		if chain := parent.chain; i == start && chain != nil {
+			if n := chain.skip(path[start:end]); n > 0 {
+				parent = chain.end
+				matched.MatchedDepth += chain.depth
+				matched.LastNode = parent
+				i = start + n
+				start = i + 1
+				continue
+			}
+		}
+		if i < end && path[i] != '/' {
+			continue
+		}
+		segment := path[start:i]
+		node := parent.children[segment]
+		if node == nil && t.ignoreCase {
+			node = parent.children[t.caseFold(segment)]
+		}
+		if node == nil {
+			// TrailingSlashRedirect: /abc/efg/ -> /abc/efg
+			if t.tsr && parent.endpoint && !parent.exact && i == end && segment == "" {
+				t.redirect(matched, path[:end-1], fixed)
+			}
+			return matched
+		}
+
+		parent = node
+		matched.MatchedDepth++
+		matched.LastNode = node
+		start = i + 1
+	}
+
+	t.matchEndpoint(matched, parent, path, fixed)
+	return matched
+}
+
+// matchEndpoint completes the matched result with the last matched node.
+func (t *Trie) matchEndpoint(matched *Matched, node *Node, path string, fixed bool) {
+	switch {
+	case node.endpoint:
+		target := node.resolve()
+		if !target.satisfies(matched.Params) {
+			return
+		}
+		matched.Node = target
+		matched.Pattern = target.pattern
+		if fixed {
+			if !node.exact {
+				matched.FPR = path
+			}
+			matched.Node = nil
+			matched.Pattern = ""
+		}
+	case t.tsr && node.getChild("") != nil && !node.getChild("").exact:
+		// TrailingSlashRedirect: /abc/efg -> /abc/efg/
+		t.redirect(matched, path+"/", fixed)
+	}
+}
+
+// redirect sets the TrailingSlashRedirect target, or the FixedPathRedirect
+// target instead if the path was fixed.
+func (t *Trie) redirect(matched *Matched, target string, fixed bool) {
+	if fixed {
+		matched.FPR = target
+		return
+	}
+	matched.TSR = target
+}
+
+// MatchRPC splits the first segment of the path as the method, and matches the
+// rest of the path. The method must be one of Options.RPCMethods, otherwise it
+// returns an empty method and an empty Matched.
+//
+//  trie.Define("/users/:id")
+//  method, matched := trie.MatchRPC("/GET/users/42")
+//  // method == "GET", matched.Params["id"] == "42"
+//
+func (t *Trie) MatchRPC(path string) (method string, m *Matched) {
+	if path == "" || path[0] != '/' {
+		panic(newError(ErrPathNotSlash, `path is not start with "/": "%s"`, path))
+	}
+	method, rest := path[1:], "/"
+	if i := strings.IndexByte(method, '/'); i >= 0 {
+		method, rest = method[:i], method[i:]
+	}
+	method = t.normalizeMethod(method)
+	if !t.rpcMethods[method] {
+		return "", new(Matched)
+	}
+	return method, t.Match(rest)
+}
+
+// CaseCollisions returns the pairs of pattern prefixes that are defined with
+// different cases but fold to the same node when IgnoreCase enabled, in defined
+// order. The first one in a pair is the prefix defined first.
+//
+//  trie.Define("/api/users")
+//  trie.Define("/API/users")
+//  trie.CaseCollisions() // [][2]string{{"/api", "/API"}}
+//
+func (t *Trie) CaseCollisions() [][2]string {
+	return t.caseCollisions
+}
+
+func (t *Trie) addCaseCollision(defined, pattern string) {
+	collision := [2]string{defined, pattern}
+	for _, c := range t.caseCollisions {
+		if c == collision {
+			return
+		}
+	}
+	t.caseCollisions = append(t.caseCollisions, collision)
+}
+
+// MatchAll returns all the full matches for the path in specificity order, the
+// first one is the match of Match when it matches an endpoint: static children
+// first, then the vary children in the order Match tries them. It doesn't fix
+// the path or compute redirects. It can be used to inspect overlapping patterns
+// or to route shadow traffic.
+//
+//  trie.Define("/files/readme")
+//  trie.Define("/files/:name")
+//  trie.Define("/files/:path*")
+//  len(trie.MatchAll("/files/readme")) // 3
+//
+func (t *Trie) MatchAll(path string) []*Matched {
+	if path == "" || path[0] != '/' {
+		panic(newError(ErrPathNotSlash, `path is not start with "/": "%s"`, path))
+	}
+	var results []*Matched
+	t.matchAll(t.root, path, 1, nil, &results)
+	return results
+}
+
+// matchStep is a node matched by MatchAll with the value it captures.
+type matchStep struct {
+	node  *Node
+	value string
+}
+
+func (t *Trie) matchAll(parent *Node, path string, start int, steps []matchStep, results *[]*Matched) {
+	end := strings.IndexByte(path[start:], '/')
+	last := end < 0
+	if last {
+		end = len(path)
+	} else {
+		end += start
+	}
+	segment := path[start:end]
+	rest := path[start:]
+	if t.wildcardSlash {
+		rest = path[start-1:]
+	}
+
+	var candidates []*Node
+	if child := parent.getChild(segment); child != nil {
+		candidates = append(candidates, child)
+	}
+	if t.ignoreCase {
+		if child := parent.getChild(t.caseFold(segment)); child != nil && (len(candidates) == 0 || candidates[0] != child) {
+			candidates = append(candidates, child)
+		}
+	}
+	if !parent.literal {
+		for _, child := range parent.varyChildren {
+			if child.matchVary(segment, rest, nil) || t.ignoreCase && child.matchVary(t.caseFold(segment), rest, nil) {
+				candidates = append(candidates, child)
+			}
+		}
+	}
+
+	for _, child := range candidates {
+		if !child.isEnabled() {
+			continue
+		}
+		value := segment
+		if child.wildcard {
+			value = rest
+		} else if child.suffix != "" {
+			value = segment[0 : len(segment)-len(child.suffix)]
+		}
+		next := append(steps[:len(steps):len(steps)], matchStep{child, value})
+		if !last && !child.wildcard {
+			t.matchAll(child, path, end+1, next, results)
+			continue
+		}
+		if !child.endpoint {
+			continue
+		}
+
+		target := child.resolve()
+		matched := &Matched{Node: target, Pattern: target.pattern, MatchedDepth: len(next), LastNode: child}
+		for _, step := range next {
+			if step.node.name != "" || step.node.anonymous {
+				matched.capture(step.node, step.value)
+			}
+		}
+		if (t.maxParams == 0 || len(matched.Params)+len(matched.Positional) <= t.maxParams) &&
+			target.satisfies(matched.Params) {
+			*results = append(*results, matched)
+		}
+	}
+}
+
+// MatchPartial matches the path like Match, and if the path doesn't match, the
+// params captured on the segments matched before it failed are kept in
+// Matched.Params, and Matched.Tail is the unmatched rest of the path. It can be
+// used by middleware to read prefix params such as a tenant even for a 404.
+//
+//  trie.Define("/t/:tenant/users")
+//  matched := trie.MatchPartial("/t/acme/unknown")
+//  // matched.Node == nil, matched.Params["tenant"] == "acme", matched.Tail == "/unknown"
+//
+func (t *Trie) MatchPartial(path string) *Matched {
+	matched := t.Match(path)
+	if matched.Node != nil {
+		return matched
+	}
+	if t.fpr {
+		path = fixPath(path)
+	}
+	index := 0
+	for i := 0; i < matched.MatchedDepth; i++ {
+		next := strings.IndexByte(path[index+1:], '/')
+		if next < 0 {
+			index = len(path)
+			break
+		}
+		index += next + 1
+	}
+	matched.Tail = path[index:]
+	return matched
+}
+
+// MatchLongest matches the path like Match, but if the path doesn't match an
+// endpoint, it returns the deepest endpoint node passed through with the params
+// captured up to it, and Matched.Tail is the unconsumed rest of the path. It can be
+// used for hierarchical fallback handlers. Nodes marked by Node.Exact are only
+// returned for the whole path. Redirects are not suggested in this mode, the path
+// is not fixed and Matched.FPR and Matched.TSR are always empty.
+//
+//  trie.Define("/a/b")
+//  matched := trie.MatchLongest("/a/b/c")
+//  // matched.Pattern == "/a/b", matched.Tail == "/c"
+//
+func (t *Trie) MatchLongest(path string) *Matched {
+	if path == "" || path[0] != '/' {
+		panic(newError(ErrPathNotSlash, `path is not start with "/": "%s"`, path))
+	}
+
+	matched := new(Matched)
+	var best *Node
+	bestAt, bestDepth, bestOrdered, bestPositional := 0, 0, 0, 0
+	start := 1
+	end := len(path)
+	parent := t.root
+	for i := 1; i <= end; i++ {
+		if i < end && path[i] != '/' {
+			continue
+		}
+		segment := path[start:i]
+		rest := path[start:end]
+		if t.wildcardSlash {
+			rest = path[start-1 : end]
+		}
+		node := t.matchSegment(parent, segment, rest, nil)
+		if node == nil {
+			break
+		}
+
+		parent = node
+		matched.MatchedDepth++
+		matched.LastNode = node
+		if node.name != "" || node.anonymous {
+			value := segment
+			if node.wildcard {
+				value = rest
+				i = end
+			} else if node.suffix != "" {
+				value = segment[0 : len(segment)-len(node.suffix)]
+			}
+			matched.capture(node, value)
+		}
+		if node.endpoint && (!node.exact || i == end) && node.resolve().satisfies(matched.Params) {
+			best, bestAt, bestDepth = node, i, matched.MatchedDepth
+			bestOrdered, bestPositional = len(matched.ordered), len(matched.Positional)
+		}
+		if node.wildcard {
+			break
+		}
+		start = i + 1
+	}
+	if best == nil {
+		return matched
+	}
+
+	matched.Node = best.resolve()
+	matched.Pattern = matched.Node.pattern
+	matched.Tail = path[bestAt:]
+	matched.MatchedDepth = bestDepth
+	matched.ordered = matched.ordered[:bestOrdered]
+	matched.Positional = matched.Positional[:bestPositional]
+	matched.Params = nil
+	for _, param := range matched.ordered {
+		if matched.Params == nil {
+			matched.Params = make(map[string]string)
+		}
+		matched.Params[param.Name] = param.Value
+	}
+	return matched
+}
+
+// MatchMethod matches the path like Match and checks the method on the matched
+// node. The Node is set even if the node has no handler for the method, so it
+// can be used for a custom 405 response, and Matched.Allow is set to the allow
+// methods of the node in that case.
+//
+//  matched := trie.MatchMethod("POST", "/a")
+//  if matched.Node != nil && matched.Allow != "" {
+//  	// 405, matched.Allow == "GET, PUT"
+//  }
+//
+func (t *Trie) MatchMethod(method, path string) *Matched {
+	matched := t.Match(path)
+	if matched.Node != nil && matched.Handler(method) == nil {
+		matched.Allow = matched.Node.GetAllow()
+	}
+	return matched
+}
+
+// Lookup matches the path and returns the handler for the method resolved by
+// Matched.Handler with the Matched result. It returns the not found handler
+// when no node matched and no redirect is suggested, or the handler registered
+// by SetMethodNotAllowed when the node has no handler for the method. The not
+// found handler is the one registered by Node.SetNotFound on the deepest
+// reached node or its nearest ancestor, or the one registered by
+// Trie.SetNotFound.
+//
+//  handler, matched := trie.Lookup("GET", "/a/b")
+//
+func (t *Trie) Lookup(method, path string) (interface{}, *Matched) {
+	matched := t.MatchMethod(method, path)
+	if matched.Node == nil {
+		if _, ok := matched.RedirectTarget(); ok {
+			return nil, matched
+		}
+		for node := matched.LastNode; node != nil; node = node.parent {
+			if node.notFound != nil {
+				return node.notFound, matched
+			}
+		}
+		return t.notFound, matched
+	}
+	if handler := matched.Handler(method); handler != nil {
+		return handler, matched
+	}
+	return t.methodNotAllowed, matched
+}
+
+// SetNotFound registers the handler returned by Lookup for unmatched paths.
+func (t *Trie) SetNotFound(handler interface{}) {
+	t.checkFrozen()
+	t.notFound = handler
+}
+
+// NotFound returns the handler registered by SetNotFound.
+func (t *Trie) NotFound() interface{} {
+	return t.notFound
+}
+
+// SetMethodNotAllowed registers the handler returned by Lookup for matched
+// paths without a handler for the method.
+func (t *Trie) SetMethodNotAllowed(handler interface{}) {
+	t.checkFrozen()
+	t.methodNotAllowed = handler
+}
+
+// MethodNotAllowed returns the handler registered by SetMethodNotAllowed.
+func (t *Trie) MethodNotAllowed() interface{} {
+	return t.methodNotAllowed
+}
+
+// Walk walks the trie in depth-first order and calls fn for every endpoint node
+// with the pattern reconstructed from the original fragments of the nodes,
+// including regexp bodies, suffixes and "::" escapes.
+//
+//  trie.Define("/users/:id([0-9]+)")
+//  trie.Walk(func(pattern string, node *Node) {
+//  	fmt.Println(pattern) // "/users/:id([0-9]+)"
+//  })
+//
+func (t *Trie) Walk(fn func(pattern string, n *Node)) {
+	t.WalkFunc(func(pattern string, n *Node) bool {
+		if n.endpoint {
+			fn(pattern, n)
+		}
+		return true
+	})
+}
+
+// WalkFunc walks the trie in depth-first order and calls fn for every node
+// with the node's pattern. Static children are visited in lexical order before
+// the parameter children. If fn returns false, the node's children are skipped.
+//
+//  trie.WalkFunc(func(pattern string, node *Node) bool {
+//  	return pattern == "/admin" || strings.HasPrefix(pattern, "/admin/")
+//  })
+//
+func (t *Trie) WalkFunc(fn func(pattern string, n *Node) (descend bool)) {
+	walkNode(t.root, fn)
+}
+
+// Orphans returns the patterns of the endpoint nodes without any handler, such
+// as a pattern defined by Define but never handled, in Walk order. Handlers
+// inherited from Node.HandleSubtree are not counted, an alias counts the
+// handlers of the node it resolves to. It can be used as a guard
+// for route tables in tests.
+//
+//  trie.Define("/a")
+//  trie.Orphans() // []string{"/a"}
+//
+func (t *Trie) Orphans() []string {
+	var patterns []string
+	t.Walk(func(pattern string, n *Node) {
+		if !n.resolve().HasHandlers() {
+			patterns = append(patterns, pattern)
+		}
+	})
+	return patterns
+}
+
+// Unreachable returns the defined patterns that can never be matched, because a
+// parameter sibling tried before them always matches first. For example
+// "/files/:path*" is unreachable after "/files/:name", as ":name" matches every
+// segment, even the empty one of "/files/". With Options.StrictEmptyParams,
+// ":name" doesn't match "/files/" but ":path*" does, so it is not reported.
+// It can be used as a guard for route tables in tests.
+func (t *Trie) Unreachable() []string {
+	var patterns []string
+	t.WalkFunc(func(pattern string, n *Node) bool {
+		if n.parent == nil || !n.parent.shadows(n) {
+			return true
+		}
+		if n.endpoint {
+			patterns = append(patterns, pattern)
+		}
+		walkNode(n, func(pattern string, child *Node) bool {
+			if child.endpoint {
+				patterns = append(patterns, pattern)
+			}
+			return true
+		})
+		return false
+	})
+	return patterns
+}
+
+// Fingerprint returns a SHA-256 hex digest of the patterns of the endpoint nodes and
+// their handled methods. It doesn't depend on the order of definition, so two tries
+// with the same routes have the same fingerprint. It can be used for cache
+// invalidation and to detect drifts of route tables.
+func (t *Trie) Fingerprint() string {
+	var routes []string
+	t.Walk(func(pattern string, n *Node) {
+		methods := append([]string(nil), n.resolve().loadHandlers().methods...)
+		sort.Strings(methods)
+		routes = append(routes, pattern+" "+strings.Join(methods, ","))
+	})
+	sort.Strings(routes)
+
+	hash := sha256.New()
+	for _, route := range routes {
+		hash.Write([]byte(route))
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Endpoint is a method handled on an endpoint node, it is returned by Trie.Endpoints.
+type Endpoint struct {
+	// The pattern of the endpoint node as Walk reports it.
+	Pattern string
+	// The method key the handler is mounted with, it can be composite, such as "GET+json".
+	Method string
+	// The handler mounted with the method.
+	Handler interface{}
+}
+
+// Endpoints returns one Endpoint for every method handled on every endpoint node,
+// sorted by pattern and then by method. Endpoint nodes without any handler are
+// not included, see Orphans. It can be used to generate reports or per-operation
+// API documents.
+//
+//  trie.Define("/users/:id").Handle("GET", getUser)
+//  trie.Define("/users/:id").Handle("DELETE", deleteUser)
+//  trie.Endpoints()
+//  // []Endpoint{{"/users/:id", "DELETE", deleteUser}, {"/users/:id", "GET", getUser}}
+//
+func (t *Trie) Endpoints() []Endpoint {
+	var endpoints []Endpoint
+	t.Walk(func(pattern string, n *Node) {
+		set := n.resolve().loadHandlers()
+		for _, method := range set.methods {
+			endpoints = append(endpoints, Endpoint{pattern, method, set.handlers[method]})
+		}
+	})
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		if endpoints[i].Pattern != endpoints[j].Pattern {
+			return endpoints[i].Pattern < endpoints[j].Pattern
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+	return endpoints
+}
+
+// TrieStats describes the shape of a trie, it is returned by Trie.Stats.
+type TrieStats struct {
+	// The number of nodes, not including the root.
+	NodeCount int
+	// The number of endpoint nodes defined by patterns.
+	EndpointCount int
+	// The number of segments of the deepest node.
+	MaxDepth int
+	// The number of parameter nodes, including wildcard and regexp ones.
+	ParamNodes int
+	// The number of catch-all parameter nodes.
+	WildcardNodes int
+	// The number of regexp parameter nodes.
+	RegexNodes int
+}
+
+// Stats returns the statistics of the trie computed by a single traversal.
+func (t *Trie) Stats() TrieStats {
+	var stats TrieStats
+	statNode(t.root, 0, &stats)
+	return stats
+}
+
+// Matched is a result returned by Trie.Match.
+type Matched struct {
+	// Either a Node pointer when matched or nil
+	Node *Node
+
+	// Either a map contained matched values or empty map.
+	Params map[string]string
+
+	// The values captured by anonymous parameters in path order,
+	// see Options.AnonymousParams.
+	Positional []string
+
+	// The pattern defined for the matched node, such as "/users/:id",
+	// or an empty string when not matched.
+	Pattern string
+
+	// If FixedPathRedirect or NormalizePercentEncoding enabled, it may returns
+	// a redirect path, otherwise a empty string. It is empty when Node is not nil, and takes
+	// precedence over TSR: it holds the TSR target for a fixed path.
+	FPR string
+
+	// If TrailingSlashRedirect enabled, it may returns a redirect path,
+	// otherwise a empty string. It is empty when Node is not nil or FPR is set.
+	TSR string
+
+	// The allow methods of the matched node set by Trie.MatchMethod and Lookup
+	// when the node has no handler for the method, otherwise an empty string.
+	Allow string
+
+	// The number of path segments that matched successfully, also on failure.
+	MatchedDepth int
+
+	// The unconsumed rest of the path returned by Trie.MatchLongest, such as "/c"
+	// for "/a/b/c" when "/a/b" is the deepest endpoint, or the unmatched rest of
+	// the path returned by Trie.MatchPartial, otherwise an empty string.
+	Tail string
+
+	// The number of regexp evaluations of parameter nodes performed by Match,
+	// it is counted only when Options.TrackRegexEvals enabled.
+	RegexEvals int
+
+	// The deepest node reached by matching, or nil if no segment matched.
+	// It can be used to build suggestions from its siblings on failure.
+	LastNode *Node
+
+	ordered []Param
+}
+
+// Param is a named parameter with its captured value.
+type Param struct {
+	Name  string
+	Value string
+}
+
+// capture saves the value of the parameter node.
+func (m *Matched) capture(node *Node, value string) {
+	if node.anonymous {
+		for _, fn := range node.transforms {
+			value = fn(value)
+		}
+		m.Positional = append(m.Positional, value)
+		return
+	}
+	if m.Params == nil {
+		m.Params = make(map[string]string)
+	}
+	format := ""
+	if node.format != "" {
+		index := strings.LastIndexByte(value, '.')
+		value, format = value[:index], value[index+1:]
+	}
+	for _, fn := range node.transforms {
+		value = fn(value)
+	}
+	m.Params[node.name] = value
+	m.ordered = append(m.ordered, Param{node.name, value})
+	if node.format != "" {
+		m.Params[node.format] = format
+		m.ordered = append(m.ordered, Param{node.format, format})
+	}
+}
+
+// OrderedParams returns the named parameters in the order their nodes appear from
+// the root to the matched node, it can be used to build a canonical key for the route.
+//
+//  trie.Define("/a/:x/b/:y")
+//  trie.Match("/a/1/b/2").OrderedParams() // []Param{{"x", "1"}, {"y", "2"}}
+//
+func (m *Matched) OrderedParams() []Param {
+	return append([]Param(nil), m.ordered...)
+}
+
+// Found returns true if the path matched an endpoint node.
+func (m *Matched) Found() bool {
+	return m.Node != nil
+}
+
+// ParamsCopy returns an independent copy of Params that is safe to retain
+// beyond the lifecycle of the match, such as in a context value. Matched.Params
+// itself may be reused for later matches and should not be retained.
+func (m *Matched) ParamsCopy() map[string]string {
+	params := make(map[string]string, len(m.Params))
+	for key, value := range m.Params {
+		params[key] = value
+	}
+	return params
+}
+
+// RedirectTarget returns the redirect path produced by FixedPathRedirect or
+// TrailingSlashRedirect, and whether there is one. Match never sets both of them.
+func (m *Matched) RedirectTarget() (path string, ok bool) {
+	if m.FPR != "" {
+		return m.FPR, true
+	}
+	if m.TSR != "" {
+		return m.TSR, true
+	}
+	return "", false
+}
+
+// Handler returns the effective handler for the method on the matched node, or
+// nil. The handler mounted with the method is preferred, then a "HEAD" request
+// falls back to the "GET" handler, and then to the handler mounted with "*".
+// If the node has none of them, the handlers mounted by Node.HandleSubtree on
+// the node and its ancestors are resolved in the same way, nearest first.
+// Method names are compared in canonical case when Options.IgnoreMethodCase is enabled.
+func (m *Matched) Handler(method string) interface{} {
+	if m.Node == nil {
+		return nil
+	}
+	method = m.Node.trie.normalizeMethod(method)
+	if handler := resolveHandler(m.Node.loadHandlers().handlers, method); handler != nil {
+		return handler
+	}
+	for node := m.Node; node != nil; node = node.parent {
+		if handler := resolveHandler(node.subtreeHandlers, method); handler != nil {
+			return handler
+		}
+	}
+	return nil
+}
+
+// resolveHandler returns the handler for the normalized method, falls back to
+// "GET" for "HEAD", and then to "*".
+func resolveHandler(handlers map[string]interface{}, method string) interface{} {
+	if handler := handlers[method]; handler != nil {
+		return handler
+	}
+	if method == "HEAD" {
+		if handler := handlers["GET"]; handler != nil {
+			return handler
+		}
+	}
+	return handlers["*"]
+}
+
+// Node represents a node on defined patterns that can be matched.
+//
+// The segment of a node is the fragment as it was defined, it is used to
+// reconstruct patterns and paths, while a static node is keyed by its key in the
+// children of its parent, the segment unescaped and folded for Options.IgnoreCase.
+type Node struct {
+	name, pattern, segment, suffix         string
+	format, key                            string
+	endpoint, wildcard, anonymous, literal bool
+	exact, fallback, optional, nonEmpty    bool
+	trie                                   *Trie
+	parent                                 *Node
+	varyChildren                           []*Node
+	children                               map[string]*Node
+	handlers                               atomic.Value // *handlerSet
+	regex                                  *regexp.Regexp
+	queries                                []queryConstraint
+	validators                             []func(string) bool
+	transforms                             []func(string) string
+	constraints                            []func(map[string]string) bool
+	onMatch                                []func(map[string]string)
+	file                                   string
+	line                                   int
+	priority                               int
+	defaults                               map[string]string
+	delegate                               func(string) *Matched
+	id                                     int
+	subtreeHandlers                        map[string]interface{}
+	middleware                             []interface{}
+	enabled                                func() bool
+	notFound                               interface{}
+	regexGroup                             *regexGroup
+	aliasOf                                *Node
+	chain                                  *staticChain
+}
+
+// handlerSet is the handlers mounted on a node, it is never modified after it
+// is stored on the node, so a change is published as a whole.
+type handlerSet struct {
+	handlers map[string]interface{}
+	// the method keys in the order they were mounted
+	methods []string
+	// the value of GetAllow
+	allow string
+}
+
+var emptyHandlerSet = new(handlerSet)
+
+// loadHandlers returns the handlers mounted on the node.
+func (n *Node) loadHandlers() *handlerSet {
+	if set, ok := n.handlers.Load().(*handlerSet); ok {
+		return set
+	}
+	return emptyHandlerSet
+}
+
+// storeHandlers stores the handlers with the method keys in mount order on the node.
+// The set is swapped with the one it replaces, so concurrent calls from
+// ReplaceHandlers count the node in Trie.Len exactly once.
+func (n *Node) storeHandlers(handlers map[string]interface{}, methods []string) {
+	set := &handlerSet{handlers: handlers, methods: methods}
+	set.allow = strings.Join(n.trie.baseMethods(methods), ", ")
+	for {
+		old := n.handlers.Load()
+		prev := 0
+		if old != nil {
+			prev = len(old.(*handlerSet).handlers)
+		}
+		if !n.handlers.CompareAndSwap(old, set) {
+			continue
+		}
+		switch {
+		case prev == 0 && len(handlers) > 0:
+			atomic.AddInt64(&n.trie.handled, 1)
+		case prev > 0 && len(handlers) == 0:
+			atomic.AddInt64(&n.trie.handled, -1)
+		}
+		return
+	}
+}
+
+// setHandler stores the handlers of the node with the handler of the method key
+// added or replaced.
+func (n *Node) setHandler(method string, handler interface{}) {
+	set := n.loadHandlers()
+	handlers := make(map[string]interface{}, len(set.handlers)+1)
+	for m, h := range set.handlers {
+		handlers[m] = h
+	}
+	methods := set.methods
+	if _, ok := handlers[method]; !ok {
+		methods = append(methods[:len(methods):len(methods)], method)
+	}
+	handlers[method] = handler
+	n.storeHandlers(handlers, methods)
+}
+
+type queryConstraint struct {
+	key   string
+	regex *regexp.Regexp
+}
+
+// setEndpoint marks the node as an endpoint and assigns its ID.
+func (n *Node) setEndpoint() {
+	if !n.endpoint {
+		n.endpoint = true
+		n.trie.lastID++
+		n.id = n.trie.lastID
+	}
+}
+
+func (n *Node) getSegments() string {
+	segments := n.segment
+	if n.parent != nil {
+		segments = n.parent.getSegments() + "/" + segments
+	}
+	return segments
+}
+
+func (n *Node) getChild(key string) *Node {
+	return n.children[key]
+}
+
+// shadows returns true if a vary child before the child matches every segment
+// that the child could match.
+func (n *Node) shadows(child *Node) bool {
+	for _, prev := range n.varyChildren {
+		if prev == child {
+			return false
+		}
+		// a parameter that rejects an empty segment doesn't shadow one that matches it,
+		// nor does one with validators or a predicate, as they can reject any segment
+		if prev.regex != nil || prev.wildcard || prev.format != "" ||
+			len(prev.validators) > 0 || prev.enabled != nil ||
+			prev.rejectsEmpty() && !child.rejectsEmpty() {
+			continue
+		}
+		if prev.suffix == "" || child.suffix != "" && strings.HasSuffix(child.suffix, prev.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWildcard returns true if the node has a catch-all vary child.
+func (n *Node) hasWildcard() bool {
+	for _, child := range n.varyChildren {
+		if child.wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// getChildren returns static children sorted by key, followed by vary children.
+func (n *Node) getChildren() []*Node {
+	keys := n.ChildKeys()
+	nodes := make([]*Node, 0, len(keys)+len(n.varyChildren))
+	for _, key := range keys {
+		nodes = append(nodes, n.children[key])
+	}
+	return append(nodes, n.varyChildren...)
+}
+
+// Define defines the sub-pattern beneath the node like Trie.Define, and returns
+// the endpoint node. The pattern of the endpoint node is the node's pattern joined
+// with the sub-pattern.
+//
+//  users := trie.Define("/users")
+//  posts := users.Define("/:id/posts")
+//  // posts == trie.Define("/users/:id/posts")
+//
+func (n *Node) Define(subPattern string) *Node {
+	return n.trie.define(n, subPattern, 2)
+}
+
+// Handle is used to mount a handler with a method name to the node.
+//
+//  t := New()
+//  node := t.Define("/a/b")
+//  node.Handle("GET", handler1)
+//  node.Handle("POST", handler1)
+//
+func (n *Node) Handle(method string, handler interface{}) {
+	n.trie.checkFrozen()
+	method = n.trie.normalizeMethod(method)
+	if n.GetHandler(method) != nil {
+		panic(newError(ErrHandlerExists, `"%s" already defined`, n.getSegments()))
+	}
+	n.setHandler(method, handler)
+}
+
+// Remove unmounts the handler with the method name from the node, it returns
+// false if the node has no handler for the method.
+//
+//  node := trie.Define("/a")
+//  node.Handle("GET", handler)
+//  node.Remove("GET") // true
+//
+func (n *Node) Remove(method string) bool {
+	n.trie.checkFrozen()
+	method = n.trie.normalizeMethod(method)
+	set := n.loadHandlers()
+	if set.handlers[method] == nil {
+		return false
+	}
+	handlers := make(map[string]interface{}, len(set.handlers))
+	var methods []string
+	for _, m := range set.methods {
+		if m != method {
+			handlers[m] = set.handlers[m]
+			methods = append(methods, m)
+		}
+	}
+	n.storeHandlers(handlers, methods)
+	return true
+}
+
+// ReplaceHandlers replaces all the handlers mounted on the node with the handlers
+// keyed by method at once, and recomputes GetAllow. The methods are mounted in
+// sorted order. It is safe to call while the trie is matching in other goroutines,
+// they get either the previous handlers or the new ones, never a mix of them, so
+// it is allowed on a frozen trie for zero-downtime handler upgrades. Nil handlers
+// are dropped. It panics with ErrNotDefined if the node is not an endpoint.
+//
+//  node.ReplaceHandlers(map[string]interface{}{"GET": getV2, "POST": postV2})
+//
+func (n *Node) ReplaceHandlers(handlers map[string]interface{}) {
+	if !n.endpoint {
+		panic(newError(ErrNotDefined, `"%s" is not an endpoint`, n.getSegments()))
+	}
+	set := make(map[string]interface{}, len(handlers))
+	methods := make([]string, 0, len(handlers))
+	for method, handler := range handlers {
+		if handler == nil {
+			continue
+		}
+		method = n.trie.normalizeMethod(method)
+		if _, ok := set[method]; !ok {
+			methods = append(methods, method)
+		}
+		set[method] = handler
+	}
+	sort.Strings(methods)
+	n.storeHandlers(set, methods)
+}
+
+// HandleSubtree mounts a fallback handler with a method name to the node, it is
+// inherited by the node and its descendant endpoints that have no handler for the
+// method, see Matched.Handler.
+//
+//  trie.Define("/admin").HandleSubtree("GET", authHandler)
+//  trie.Define("/admin/users")
+//  trie.Match("/admin/users").Handler("GET") // authHandler
+//
+func (n *Node) HandleSubtree(method string, handler interface{}) {
+	n.trie.checkFrozen()
+	method = n.trie.normalizeMethod(method)
+	if n.subtreeHandlers == nil {
+		n.subtreeHandlers = make(map[string]interface{})
+	}
+	if n.subtreeHandlers[method] != nil {
+		panic(newError(ErrHandlerExists, `"%s" subtree handler already defined`, n.getSegments()))
+	}
+	n.subtreeHandlers[method] = handler
+}
+
+// SetNotFound registers the handler returned by Trie.Lookup for unmatched paths
+// beneath the node, it takes precedence over the handlers of the ancestors and
+// the one registered by Trie.SetNotFound.
+//
+//  trie.Define("/api").SetNotFound(jsonNotFound)
+//  trie.Define("/web").SetNotFound(htmlNotFound)
+//  handler, _ := trie.Lookup("GET", "/api/missing") // jsonNotFound
+//
+func (n *Node) SetNotFound(handler interface{}) {
+	n.trie.checkFrozen()
+	n.notFound = handler
+}
+
+// OnMatch registers a hook that is called by Match with the captured params when
+// the node is the matched endpoint, such as to count the matches of routes. Hooks
+// are called in the order they were registered, and a node without hooks costs
+// nothing. Match doesn't copy the params for hooks, they must not modify them.
+//
+//  trie.Define("/users/:id").OnMatch(func(params map[string]string) {
+//  	userHits.Inc()
+//  })
+//
+func (n *Node) OnMatch(fn func(params map[string]string)) {
+	n.trie.checkFrozen()
+	n.onMatch = append(n.onMatch, fn)
+}
+
+// Use appends middleware to the node, it is inherited by the node and its descendants.
+//
+//  trie.Define("/admin").Use(auth)
+//
+func (n *Node) Use(mw ...interface{}) {
+	n.trie.checkFrozen()
+	n.middleware = append(n.middleware, mw...)
+}
+
+// Middleware returns the middleware chain for the node in order: the global
+// middleware of the trie first, then the middleware of the ancestors from the
+// root, and the middleware of the node itself last.
+//
+//  trie.Use(logger)
+//  trie.Define("/admin").Use(auth)
+//  trie.Define("/admin/users").Use(audit)
+//  trie.Define("/admin/users").Middleware() // []interface{}{logger, auth, audit}
+//
+func (n *Node) Middleware() []interface{} {
+	var chain []interface{}
+	for node := n; node != nil; node = node.parent {
+		chain = append(node.middleware[:len(node.middleware):len(node.middleware)], chain...)
+	}
+	return append(n.trie.middleware[:len(n.trie.middleware):len(n.trie.middleware)], chain...)
+}
+
+// HasHandlers returns true if any handler is mounted on the node.
+func (n *Node) HasHandlers() bool {
+	return len(n.loadHandlers().handlers) > 0
+}
+
+// GetHandler ...
+// GetHandler returns handler by method that defined on the node
+//
+//  trie := New()
+//  trie.Define("/api").Handle("GET", func handler1() {})
+//  trie.Define("/api").Handle("PUT", func handler2() {})
+//
+//  trie.Match("/api").Node.GetHandler("GET").(func()) == handler1
+//  trie.Match("/api").Node.GetHandler("PUT").(func()) == handler2
+//
+func (n *Node) GetHandler(method string) interface{} {
+	return n.loadHandlers().handlers[n.trie.normalizeMethod(method)]
+}
+
+// GetHandlers returns the handlers on the node whose method keys start with the
+// prefix. Method keys can be composite, such as "GET+json" and "GET+xml" for
+// content negotiation, then GetHandlers("GET") returns both of them with "GET".
+//
+//  node.Handle("GET+json", jsonHandler)
+//  node.Handle("GET+xml", xmlHandler)
+//  node.GetHandlers("GET+") // map[string]interface{}{"GET+json": jsonHandler, "GET+xml": xmlHandler}
+//
+func (n *Node) GetHandlers(prefix string) map[string]interface{} {
+	prefix = n.trie.normalizeMethod(prefix)
+	handlers := make(map[string]interface{})
+	for method, handler := range n.loadHandlers().handlers {
+		if strings.HasPrefix(method, prefix) {
+			handlers[method] = handler
+		}
+	}
+	return handlers
+}
+
+// EachHandler calls fn for every method and its handler mounted on the node,
+// in the order they were mounted.
+//
+//  trie.Define("/api").EachHandler(func(method string, handler interface{}) {
+//  	fmt.Println(method)
+//  })
+//
+func (n *Node) EachHandler(fn func(method string, handler interface{})) {
+	set := n.loadHandlers()
+	for _, method := range set.methods {
+		fn(method, set.handlers[method])
+	}
+}
+
+// GetAllow returns allow methods defined on the node, it is the methods returned
+// by GetMethods joined with ", ".
+//
+//  trie := New()
+//  trie.Define("/").Handle("GET", handler1)
+//  trie.Define("/").Handle("PUT", handler2)
+//
+//  // trie.Match("/").Node.GetAllow() == "GET, PUT"
+//
+func (n *Node) GetAllow() string {
+	return n.loadHandlers().allow
+}
+
+// GetMethods returns the base methods of the handlers on the node in the order
+// they were mounted, composite method keys with the same base method are listed
+// once, see Options.VariantSeparator.
+//
+//  node.Handle("GET+json", jsonHandler)
+//  node.Handle("GET+xml", xmlHandler)
+//  node.Handle("POST", handler)
+//  node.GetMethods() // []string{"GET", "POST"}
+//
+func (n *Node) GetMethods() []string {
+	return n.trie.baseMethods(n.loadHandlers().methods)
+}
+
+// baseMethods returns the base methods of the method keys without duplicates.
+func (t *Trie) baseMethods(keys []string) []string {
+	methods := make([]string, 0, len(keys))
+	for _, method := range keys {
+		if i := strings.Index(method, t.variantSep); i > 0 {
+			method = method[:i]
+		}
+		found := false
+		for _, m := range methods {
+			if m == method {
+				found = true
+				break
+			}
+		}
+		if !found {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// GetVariants returns the variants of the composite method keys with the base
+// method on the node in the order they were mounted, see Options.VariantSeparator.
+//
+//  node.Handle("GET+json", jsonHandler)
+//  node.Handle("GET+xml", xmlHandler)
+//  node.GetVariants("GET") // []string{"json", "xml"}
+//
+func (n *Node) GetVariants(method string) []string {
+	prefix := n.trie.normalizeMethod(method) + n.trie.variantSep
+	var variants []string
+	for _, m := range n.loadHandlers().methods {
+		if strings.HasPrefix(m, prefix) {
+			variants = append(variants, m[len(prefix):])
+		}
+	}
+	return variants
+}
+
+// ID returns the ID of the endpoint node, it is assigned in defined order from 1
+// and stable for the lifetime of the trie. It is 0 for a node that is not an endpoint.
+// It can be used as a compact route label for metrics and tracing.
+//
+//  trie.Define("/a").ID() // 1
+//  trie.Define("/b").ID() // 2
+//  trie.Define("/a").ID() // 1
+//
+func (n *Node) ID() int {
+	return n.id
+}
+
+// GetPattern returns pattern defined on the node
+func (n *Node) GetPattern() string {
+	return n.pattern
+}
+
+// SamePattern returns true if the other node is defined by the same pattern as
+// the node, the nodes can be from different tries. Define returns the same node
+// for the same pattern on a trie, so pointer equality can be used on a trie.
+//
+//  New().Define("/a/:id").SamePattern(New().Define("/a/:id")) // true
+//
+func (n *Node) SamePattern(other *Node) bool {
+	return other != nil && n.getSegments() == other.getSegments()
+}
+
+// ChildKeys returns the keys of the static children of the node in sorted order,
+// the keys are unescaped and folded for Options.IgnoreCase. It can be used with
+// HasVaryChild to explore the trie level by level.
+//
+//  trie.Define("/api/users")
+//  trie.Define("/api/Teams")
+//  trie.Define("/api/:id")
+//  trie.Match("/api").LastNode.ChildKeys() // []string{"teams", "users"}
+//
+func (n *Node) ChildKeys() []string {
+	keys := make([]string, 0, len(n.children))
+	for key := range n.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// HasVaryChild returns the name of the first parameter child of the node in match
+// order, and whether it is a catch-all. The name is empty for an anonymous
+// parameter, and ok is false if the node has no parameter child.
+//
+//  trie.Define("/files/:path*")
+//  trie.Match("/files").LastNode.HasVaryChild() // "path", true, true
+//
+func (n *Node) HasVaryChild() (name string, wildcard bool, ok bool) {
+	if len(n.varyChildren) == 0 {
+		return "", false, false
+	}
+	child := n.varyChildren[0]
+	return child.name, child.wildcard, true
+}
+
+// SetDefault sets the default value of the parameter, it is used by BuildPath on
+// the node and its descendants when the parameter is omitted. It doesn't affect matching.
+//
+//  node := trie.Define("/posts/:page")
+//  node.SetDefault("page", "1")
+//  node.BuildPath(nil) // "/posts/1", nil
+//
+func (n *Node) SetDefault(param, value string) {
+	n.trie.checkFrozen()
+	if n.defaults == nil {
+		n.defaults = make(map[string]string)
+	}
+	n.defaults[param] = value
+}
+
+// BuildPath builds a path for the node with the parameter values, a value
+// omitted from params falls back to the default set by SetDefault. It returns
+// an error if a parameter has no value, or the value doesn't match the regexp
+// and validators of the parameter. Only a catch-all parameter value can contain
+// "/".
+//
+//  node := trie.Define("/users/:user/repos/:repo(^[a-z]+$)")
+//  node.BuildPath(map[string]string{"user": "tom", "repo": "trie"}) // "/users/tom/repos/trie", nil
+//
+func (n *Node) BuildPath(params map[string]string) (string, error) {
+	var nodes []*Node
+	for node := n; node.parent != nil; node = node.parent {
+		nodes = append(nodes, node)
+	}
+
+	segments := make([]string, len(nodes))
+	for i, node := range nodes {
+		segment := node.segment
+		switch {
+		case node.parent.literal || bracketedReg.MatchString(segment):
+		case node.name != "" || node.anonymous:
+			value, ok := params[node.name]
+			if !ok {
+				value, ok = n.getDefault(node.name)
+			}
+			if !ok || node.anonymous {
+				return "", newError(ErrMissingParam, `missing param "%s" for "%s"`, node.segment, n.getSegments())
+			}
+			if node.wildcard && node.trie.wildcardSlash {
+				value = strings.TrimPrefix(value, "/")
+			}
+			if value == "" && node.rejectsEmpty() ||
+				!node.wildcard && strings.Contains(value, "/") ||
+				node.regex != nil && (value != "" || !node.optional) && !node.regex.MatchString(value) ||
+				!node.validate(value) {
+				return "", newError(ErrInvalidParam, `invalid param "%s" for "%s": "%s"`, node.segment, n.getSegments(), value)
+			}
+			if node.format != "" {
+				format, ok := params[node.format]
+				if !ok {
+					format, ok = n.getDefault(node.format)
+				}
+				if !ok {
+					return "", newError(ErrMissingParam, `missing param "%s" for "%s"`, node.segment, n.getSegments())
+				}
+				if format == "" || strings.Contains(format, ".") {
+					return "", newError(ErrInvalidParam, `invalid param "%s" for "%s": "%s"`, node.segment, n.getSegments(), format)
+				}
+				value += "." + format
+			}
+			segment = value + node.suffix
+		default:
+			segment = staticKey(node.parent, segment)
+		}
+		segments[len(nodes)-1-i] = segment
+	}
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+// getDefault returns the default value of the parameter set on the node or its ancestors.
+func (n *Node) getDefault(param string) (string, bool) {
+	for node := n; node != nil; node = node.parent {
+		if value, ok := node.defaults[param]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Delegate mounts a custom matcher on the node. When Match descends into the node
+// or its descendants but can't match an endpoint, the rest of the path after the
+// node is passed to the matcher of the nearest such node, and its result is
+// returned by Match unless it is nil. The rest is an empty string or starts with "/".
+//
+//  trie.Define("/db").Delegate(func(remaining string) *trie.Matched {
+//  	return lookupTable(remaining) // "/users/1" for "/db/users/1"
+//  })
+//
+func (n *Node) Delegate(fn func(remaining string) *Matched) {
+	n.trie.checkFrozen()
+	n.delegate = fn
+	n.trie.staticOnly = false
+}
+
+// SetEnabled sets a predicate called by Match for the node, the node and its
+// descendants are treated as non-matching when it returns false, so matching
+// falls through to the next sibling. It is called for every match through the
+// node, so it should be fast and safe for concurrent use.
+//
+//  var canary int32
+//  trie.Define("/search/v2").SetEnabled(func() bool {
+//  	return atomic.LoadInt32(&canary) == 1
+//  })
+//
+func (n *Node) SetEnabled(fn func() bool) {
+	n.trie.checkFrozen()
+	n.enabled = fn
+	n.trie.staticOnly = false
+}
+
+// Exact marks the endpoint node to be matched exactly. Match never redirects to
+// or from the node by TrailingSlashRedirect or FixedPathRedirect, so a path that
+// is only a redirect away from the node doesn't match.
+//
+//  trie.Define("/hook").Exact()
+//  trie.Match("/hook/").TSR // ""
+//
+func (n *Node) Exact() {
+	n.trie.checkFrozen()
+	n.exact = true
+}
 
-			if name[len(name)-1] == ')' {
-				if index := strings.IndexRune(name, '('); index > 0 {
-					var regex = name[index+1 : len(name)-1]
-					if len(regex) > 0 {
-						name = name[0:index]
-						node.regex = regexp.MustCompile(regex)
-					} else {
-						panic(fmt.Errorf(`invalid pattern: "%s"`, node.getSegments()))
-					}
-				}
+// Literal marks the node as the root of a literal subtree. Fragments defined
+// beneath it are static segments even if they start with ":", "::", "*" or "(",
+// and matching beneath it never considers parameter children. It should be
+// called before defining the children.
+//
+//  trie.Define("/static").Literal()
+//  trie.Define("/static/:weird") // matches "/static/:weird" only
+//
+func (n *Node) Literal() {
+	n.trie.checkFrozen()
+	n.literal = true
+}
+
+// DefinedAt returns the file and line of the Trie.Define or Trie.Route call that
+// created the node, they are included in the conflict errors. It returns an empty
+// file for a node created by LoadFrom, DefineTree, Merge or LoadSnapshot.
+//
+//  node := trie.Define("/a") // router.go:42
+//  node.DefinedAt() // "/path/to/router.go", 42
+//
+func (n *Node) DefinedAt() (file string, line int) {
+	return n.file, n.line
+}
+
+// definedAt returns the location of the node for the error messages.
+func (n *Node) definedAt() string {
+	if n.file == "" {
+		return ""
+	}
+	return fmt.Sprintf(" defined at %s:%d", filepath.Base(n.file), n.line)
+}
+
+// Fallback marks the parameter node as the fallback of its vary siblings, it is
+// tried by Match after the static sibling and all other parameter siblings failed
+// to match the segment, regardless of their priorities. Unlike a catch-all
+// parameter, a fallback parameter consumes exactly one segment.
+//
+//  trie.Define("/known")
+//  trie.Define("/:id(^[0-9]+$)")
+//  trie.Define("/:name").Fallback() // matches "/anything"
+//
+func (n *Node) Fallback() {
+	n.trie.checkFrozen()
+	n.fallback = true
+	if n.parent != nil {
+		sortVaryChildren(n.parent.varyChildren)
+	}
+}
+
+// Priority sets the priority of the parameter node among its vary siblings.
+// Siblings with higher priority are tried first by Match, siblings with the same
+// priority (default 0) are ordered by specificity: params with suffix, regex
+// params, then bare params and catch-all params. It has no effect on static nodes.
+//
+//  trie.Define("/files/:name(^[a-z0-9]+$)").Priority(1)
+//  trie.Define("/files/:id(^[0-9]+$)") // "/files/123" matches ":name"
+//
+func (n *Node) Priority(p int) {
+	n.trie.checkFrozen()
+	n.priority = p
+	if n.parent != nil {
+		sortVaryChildren(n.parent.varyChildren)
+	}
+}
+
+// RequireQuery adds a query constraint to the node, Trie.MatchQuery only
+// returns the node when one of the query values for the key matches valueRegex.
+//
+//  trie.Define("/search").RequireQuery("type", "^(image|video)$")
+//
+func (n *Node) RequireQuery(key, valueRegex string) {
+	n.trie.checkFrozen()
+	n.queries = append(n.queries, queryConstraint{key, regexp.MustCompile(valueRegex)})
+}
+
+// Validate adds a validator for the value captured by the parameter node. It is
+// called after the regexp matched, and the node doesn't match the segment if
+// any validator returns false, so matching falls through to the next sibling.
+//
+//  trie.Define("/country/:code").Validate(func(code string) bool {
+//  	return countries[code]
+//  })
+//
+func (n *Node) Validate(fn func(value string) bool) {
+	n.trie.checkFrozen()
+	n.validators = append(n.validators, fn)
+}
+
+// Transform adds a function to transform the value captured by the parameter node
+// before it is saved on Matched. It is called after the validators, and the
+// functions are applied in the order they were added.
+//
+//  trie.Define("/users/:name").Transform(strings.TrimSpace)
+//
+func (n *Node) Transform(fn func(value string) string) {
+	n.trie.checkFrozen()
+	n.transforms = append(n.transforms, fn)
+}
+
+// Constrain adds a function to check all the params captured on the matched path
+// when the node is the matched endpoint, the match fails if it returns false.
+// Unlike the validators of Node.Validate that check a single value, it can check
+// the params against each other. As Match doesn't backtrack, a failed endpoint
+// is not matched and the path doesn't match, MatchAll and MatchLongest skip it
+// for the other candidates.
+//
+//  trie.Define("/range/:from/:to").Constrain(func(params map[string]string) bool {
+//  	from, _ := strconv.Atoi(params["from"])
+//  	to, _ := strconv.Atoi(params["to"])
+//  	return from <= to
+//  })
+//
+func (n *Node) Constrain(fn func(params map[string]string) bool) {
+	n.trie.checkFrozen()
+	n.constraints = append(n.constraints, fn)
+}
+
+// satisfies returns true if the params satisfy all the constraints of the node.
+func (n *Node) satisfies(params map[string]string) bool {
+	for _, fn := range n.constraints {
+		if !fn(params) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *Node) validate(value string) bool {
+	for _, fn := range n.validators {
+		if !fn(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *Node) matchQuery(query url.Values) bool {
+	for _, c := range n.queries {
+		ok := false
+		for _, value := range query[c.key] {
+			if c.regex.MatchString(value) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// splitPattern splits the pattern into segments by "/", except the slashes in
+// the regexp of a parameter, such as "docs/:path*([a-z]+(/[a-z]+)*)".
+func splitPattern(pattern string) []string {
+	var segments []string
+	start, depth := 0, 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '(':
+			if pattern[start] == ':' {
+				depth++
+			}
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case '/':
+			if depth == 0 {
+				segments = append(segments, pattern[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segments, pattern[start:])
+}
+
+func defineNode(parent *Node, segments []string, ignoreCase bool) *Node {
+	segment := segments[0]
+	segments = segments[1:]
+	child := parseNode(parent, segment, ignoreCase)
+
+	if len(segments) == 0 {
+		child.setEndpoint()
+		return child
+	}
+	if child.wildcard {
+		panic(newError(ErrWildcardContinuation, `can't define pattern after wildcard: "%s"`, child.getSegments()))
+	}
+	return defineNode(child, segments, ignoreCase)
+}
+
+// matchSegment matches the segment on the children of parent,
+// rest is the value for a catch-all child. The probe is nil if neither counting
+// regexp evaluations nor tracing.
+func (t *Trie) matchSegment(parent *Node, segment, rest string, probe *matchProbe) *Node {
+	node := matchNode(parent, segment, rest, probe)
+	if t.ignoreCase && node == nil {
+		node = matchNode(parent, t.caseFold(segment), rest, probe)
+	}
+	return node
+}
+
+func matchNode(parent *Node, segment, rest string, probe *matchProbe) (child *Node) {
+	if probe != nil {
+		return probe.matchNode(parent, segment, rest)
+	}
+	regexFirst := parent.trie.regexFirst && !parent.literal
+	if regexFirst {
+		for _, child = range parent.varyChildren {
+			if child.regexParam() && child.isEnabled() && child.matchVary(segment, rest, nil) {
+				return
+			}
+		}
+	}
+	if child = parent.getChild(segment); child != nil && child.isEnabled() {
+		return
+	}
+	if parent.literal {
+		return nil
+	}
+	for i := 0; i < len(parent.varyChildren); i++ {
+		child = parent.varyChildren[i]
+		if regexFirst && child.regexParam() {
+			continue
+		}
+		if group := child.regexGroup; group != nil {
+			if child = group.match(segment, nil); child != nil {
+				return
 			}
+			i += len(group.nodes) - 1
+			continue
+		}
+		if child.isEnabled() && child.matchVary(segment, rest, nil) {
+			return
+		}
+	}
+	return nil
+}
+
+// regexParam returns true if the node is a regexp parameter but not a catch-all,
+// it is tried before the static siblings with Options.RegexFirst.
+func (n *Node) regexParam() bool {
+	return n.regex != nil && !n.wildcard
+}
+
+// rejectsEmpty returns true if the vary node never matches an empty segment.
+func (n *Node) rejectsEmpty() bool {
+	if n.wildcard {
+		return n.nonEmpty
+	}
+	return !n.optional && n.trie.strictEmpty
+}
+
+func (n *Node) isEnabled() bool {
+	return n.enabled == nil || n.enabled()
+}
+
+// matchVary returns true if the vary node matches the segment, rest is the value
+// for a catch-all node. The regexp evaluation is counted into evals if it is not nil.
+func (n *Node) matchVary(segment, rest string, evals *int) bool {
+	if segment == "" && !n.wildcard && !n.optional && n.trie.strictEmpty {
+		return false
+	}
+	if n.suffix != "" {
+		if segment == n.suffix || !strings.HasSuffix(segment, n.suffix) {
+			return false
+		}
+		segment = segment[0 : len(segment)-len(n.suffix)]
+	}
+	if n.wildcard {
+		segment = rest
+		if n.nonEmpty && (segment == "" || segment == "/" && n.trie.wildcardSlash) {
+			return false
+		}
+	}
+	if n.format != "" {
+		index := strings.LastIndexByte(segment, '.')
+		if index <= 0 || index == len(segment)-1 {
+			return false
+		}
+		segment = segment[:index]
+	}
+	if n.regex != nil && (segment != "" || !n.optional) {
+		if evals != nil {
+			*evals++
 		}
+		if !n.regex.MatchString(segment) {
+			return false
+		}
+	}
+	return n.validate(segment)
+}
 
-		// name must be word characters `[0-9A-Za-z_]`
-		if !wordReg.MatchString(name) {
-			panic(fmt.Errorf(`invalid pattern: "%s"`, node.getSegments()))
+func parseNode(parent *Node, segment string, ignoreCase bool) *Node {
+	_segment := staticKey(parent, segment)
+	if ignoreCase {
+		_segment = parent.trie.caseFold(_segment)
+	}
+	if node := parent.getChild(_segment); node != nil {
+		if ignoreCase && node.segment != segment {
+			parent.trie.addCaseCollision(node.getSegments(), parent.getSegments()+"/"+segment)
 		}
-		node.name = name
+		return node
+	}
+
+	node := &Node{
+		segment:  segment,
+		key:      _segment,
+		literal:  parent.literal,
+		trie:     parent.trie,
+		parent:   parent,
+		children: make(map[string]*Node),
+		file:     parent.trie.definingFile,
+		line:     parent.trie.definingLine,
+	}
+
+	switch {
+	case segment == "" || parent.literal:
+		parent.children[_segment] = node
+
+	case bracketedReg.MatchString(segment):
+		// pattern "/[::1]/status" should match "/[::1]/status"
+		parent.children[_segment] = node
+
+	case doubleColonReg.MatchString(segment):
+		// pattern "/a/::" should match "/a/:"
+		// pattern "/a/::bc" should match "/a/:bc"
+		// pattern "/a/::/bc" should match "/a/:/bc"
+		parent.children[_segment] = node
+
+	case segment[0] == '\\':
+		// pattern "/\(o_o\)" should match "/(o_o)"
+		// pattern "/\*" should match "/*"
+		parent.children[_segment] = node
+
+	case segment[0] == ':' || segment == "*" || segment == "**":
+		node.parseParam()
 		// check if node exists
 		for _, child := range parent.varyChildren {
 			if child.wildcard {
+				if node.regex != nil && !node.wildcard {
+					panic(newError(ErrPatternConflict, `regex param "%s" conflicts with catch-all "%s"%s`, node.getSegments(), child.getSegments(), child.definedAt()))
+				}
 				if !node.wildcard {
-					panic(fmt.Errorf(`can't define "%s" after "%s"`, node.getSegments(), child.getSegments()))
+					panic(newError(ErrPatternConflict, `can't define "%s" after "%s"%s`, node.getSegments(), child.getSegments(), child.definedAt()))
 				}
 				if child.name != node.name {
-					panic(fmt.Errorf(`invalid pattern name "%s", as prev defined "%s"`, node.name, child.getSegments()))
+					panic(newError(ErrPatternConflict, `invalid pattern name "%s", as prev defined "%s"%s`, node.name, child.getSegments(), child.definedAt()))
+				}
+				if child.nonEmpty != node.nonEmpty || (child.regex == nil) != (node.regex == nil) ||
+					child.regex != nil && child.regex.String() != node.regex.String() {
+					panic(newError(ErrPatternConflict, `catch-all "%s" conflicts with "%s"%s`, node.getSegments(), child.getSegments(), child.definedAt()))
 				}
 				return child
 			}
+			if node.wildcard && child.regex != nil {
+				panic(newError(ErrPatternConflict, `catch-all "%s" conflicts with regex param "%s"%s`, node.getSegments(), child.getSegments(), child.definedAt()))
+			}
 
-			if child.suffix != node.suffix {
+			if child.suffix != node.suffix || child.format != node.format {
 				continue
 			}
 
 			if !node.wildcard && (child.regex == nil && node.regex == nil) ||
-				child.regex != nil && node.regex != nil && child.regex.String() == node.regex.String() {
+				child.regex != nil && node.regex != nil && !node.wildcard && child.regex.String() == node.regex.String() {
 				if child.name != node.name {
-					panic(fmt.Errorf(`invalid pattern name "%s", as prev defined "%s"`, node.name, child.getSegments()))
+					panic(newError(ErrPatternConflict, `invalid pattern name "%s", as prev defined "%s"%s`, node.name, child.getSegments(), child.definedAt()))
+				}
+				if child.optional != node.optional {
+					panic(newError(ErrPatternConflict, `optional param "%s" conflicts with "%s"%s`, node.getSegments(), child.getSegments(), child.definedAt()))
 				}
 				return child
 			}
 		}
 		parent.varyChildren = append(parent.varyChildren, node)
-		if s := parent.varyChildren; len(s) > 1 {
-			sort.SliceStable(s, func(i, j int) bool {
-				// i > j
-				switch {
-				case s[i].suffix == "" && s[j].suffix != "":
-					return false
-				case s[i].suffix != "" && s[j].suffix == "":
-					return true
-				case s[i].regex != nil && s[j].regex == nil:
-					return true
-				default:
-					return false
-				}
-			})
+		parent.trie.staticOnly = false
+		if node.regex != nil && !node.wildcard && regexSpansSegments(node.regex.String()) {
+			node.trie.warnings = append(node.trie.warnings, fmt.Sprintf(
+				`"%s": regexp matches a single segment and never matches "/", use a catch-all like ":%s*(regexp)" to match multiple segments`,
+				node.getSegments(), node.name))
 		}
+		if node.wildcard && node.trie.fpr && node.regex != nil && regexNeedsDoubleSlash(node.regex.String()) {
+			node.trie.warnings = append(node.trie.warnings, fmt.Sprintf(
+				`"%s": the regexp of the catch-all matches "//", which FixedPathRedirect collapses before matching, so such paths are redirected instead of matching`,
+				node.getSegments()))
+		}
+		sortVaryChildren(parent.varyChildren)
 
 	case segment[0] == '*' || segment[0] == '(' || segment[0] == ')':
-		panic(fmt.Errorf(`invalid pattern: "%s"`, node.getSegments()))
+		panic(newError(ErrInvalidPattern, `invalid pattern: "%s"`, node.getSegments()))
 
 	default:
 		parent.children[_segment] = node
@@ -431,6 +2643,351 @@ func parseNode(parent *Node, segment string, ignoreCase bool) *Node {
 	return node
 }
 
+// checkFrozen panics if the trie is frozen by Freeze. It is called before every
+// modification, so it also drops the static chains to be built again by Match.
+func (t *Trie) checkFrozen() {
+	if t.frozen {
+		panic(newError(ErrFrozen, "trie is frozen"))
+	}
+	atomic.StoreInt32(&t.compressed, 0)
+}
+
+func (t *Trie) normalizeMethod(method string) string {
+	if t.ignoreMethodCase {
+		return strings.ToUpper(method)
+	}
+	return method
+}
+
+// sortVaryChildren sorts vary children by priority in descending order, then
+// by specificity: params with suffix first, then regex params, then bare params
+// in defined order, and catch-all params last.
+func sortVaryChildren(s []*Node) {
+	if len(s) < 2 {
+		return
+	}
+	sort.SliceStable(s, func(i, j int) bool {
+		// i > j
+		switch {
+		case s[i].fallback != s[j].fallback:
+			return s[j].fallback
+		case s[i].priority != s[j].priority:
+			return s[i].priority > s[j].priority
+		case s[i].wildcard != s[j].wildcard:
+			return s[j].wildcard
+		case s[i].suffix == "" && s[j].suffix != "":
+			return false
+		case s[i].suffix != "" && s[j].suffix == "":
+			return true
+		case s[i].format == "" && s[j].format != "":
+			return false
+		case s[i].format != "" && s[j].format == "":
+			return true
+		case s[i].regex != nil && s[j].regex == nil:
+			return true
+		default:
+			return false
+		}
+	})
+}
+
+// staticKey returns the key of the static segment in the children of parent.
+func staticKey(parent *Node, segment string) string {
+	switch {
+	case parent.literal:
+	case doubleColonReg.MatchString(segment):
+		return segment[1:]
+	case strings.HasPrefix(segment, `\`):
+		return unescapeSegment(segment)
+	}
+	return segment
+}
+
+// unescapeSegment removes the backslashes that escape the next characters,
+// a trailing backslash is kept.
+func unescapeSegment(segment string) string {
+	buf := make([]byte, 0, len(segment))
+	for i := 0; i < len(segment); i++ {
+		if segment[i] == '\\' && i+1 < len(segment) {
+			i++
+		}
+		buf = append(buf, segment[i])
+	}
+	return string(buf)
+}
+
+// findVaryChild returns the vary child of parent that is structurally equal to node.
+func findVaryChild(parent, node *Node) *Node {
+	for _, child := range parent.varyChildren {
+		if child.name == node.name && child.anonymous == node.anonymous &&
+			child.wildcard == node.wildcard && child.suffix == node.suffix && child.format == node.format &&
+			child.optional == node.optional && child.nonEmpty == node.nonEmpty &&
+			(child.regex == nil) == (node.regex == nil) &&
+			(child.regex == nil || child.regex.String() == node.regex.String()) {
+			return child
+		}
+	}
+	return nil
+}
+
+// parseParam parses the parameter fragment of the node, such as ":name",
+// ":name*", ":name+", ":name*(regexp)", ":name(regexp)", ":name+suffix",
+// ":name.:format", ":name?" and the globs "*" and "**".
+func (n *Node) parseParam() {
+	switch n.segment {
+	case "*":
+		// glob "*" is the anonymous parameter ":"
+		n.anonymous = true
+		return
+	case "**":
+		// glob "**" is the anonymous catch-all parameter ":*"
+		n.anonymous = true
+		n.wildcard = true
+		return
+	}
+	name := n.segment[1:]
+	// the "*(" of a catch-all regexp directly follows the name, a "*(" inside
+	// the regexp of a parameter, such as ":id(^a*(b|c)$)", doesn't count
+	open := strings.IndexByte(name, '(')
+
+	switch {
+	case strings.HasSuffix(name, "*"):
+		name = name[0 : len(name)-1]
+		n.wildcard = true
+
+	case strings.HasSuffix(name, "+") && n.isParamName(name[0:len(name)-1]):
+		// the non-empty catch-all parameter, such as ":target+", a suffix ending
+		// with "+", such as ":id+x+", is parsed by the default case
+		name = name[0 : len(name)-1]
+		n.wildcard = true
+		n.nonEmpty = true
+
+	case strings.HasSuffix(name, ")") && open > 0 && name[open-1] == '*':
+		// the regexp of catch-all parameter matches the whole remainder
+		n.compileRegex("^(?:" + name[open+1:len(name)-1] + ")$")
+		name = name[0 : open-1]
+		n.wildcard = true
+
+	default:
+		// the optional parameter, such as ":name?", can match an empty segment
+		if strings.HasSuffix(name, "?") {
+			name = name[0 : len(name)-1]
+			n.optional = true
+		}
+
+		var suffix = suffixReg.FindString(name)
+		if suffix != "" {
+			name = name[0 : len(name)-len(suffix)]
+			n.suffix = suffix[1:]
+			if n.suffix == "" {
+				panic(newError(ErrInvalidPattern, `invalid pattern: "%s"`, n.getSegments()))
+			}
+		}
+
+		// the extension parameter, such as ":format" in ":id.:format"
+		if index := strings.LastIndex(name, ".:"); index > 0 && index > strings.LastIndexByte(name, ')') {
+			n.format = name[index+2:]
+			name = name[0:index]
+			if name == "" || name[0] == '(' || !n.trie.paramNameReg.MatchString(n.format) {
+				panic(newError(ErrInvalidPattern, `invalid pattern: "%s"`, n.getSegments()))
+			}
+		}
+
+		if strings.HasSuffix(name, ")") {
+			if index := strings.IndexRune(name, '('); index > 0 || index == 0 && n.trie.anonymousParams {
+				n.compileRegex(name[index+1 : len(name)-1])
+				name = name[0:index]
+			}
+		}
+	}
+
+	// name must match Options.ParamNameRegex, word characters `[0-9A-Za-z_]` by default
+	if name == "" && n.trie.anonymousParams {
+		n.anonymous = true
+	} else if !n.trie.paramNameReg.MatchString(name) {
+		panic(newError(ErrInvalidPattern, `invalid pattern: "%s"`, n.getSegments()))
+	}
+	n.name = name
+}
+
+// isParamName reports whether the name is a bare parameter name, without any
+// "+" of a suffix.
+func (n *Node) isParamName(name string) bool {
+	if strings.IndexByte(name, '+') >= 0 {
+		return false
+	}
+	return name == "" && n.trie.anonymousParams || n.trie.paramNameReg.MatchString(name)
+}
+
+// compileRegex compiles the regexp of the parameter node.
+func (n *Node) compileRegex(regex string) {
+	if len(regex) == 0 || regex == "^(?:)$" {
+		panic(newError(ErrInvalidPattern, `invalid pattern: "%s"`, n.getSegments()))
+	}
+	if limit := n.trie.maxRegexNesting; limit > 0 && regexNesting(regex) > limit {
+		panic(newError(ErrInvalidPattern, `invalid pattern: "%s", regexp quantifiers nested deeper than %d`, n.getSegments(), limit))
+	}
+	if n.trie.regexFlags != "" {
+		regex = "(?" + n.trie.regexFlags + ")" + regex
+	}
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		panic(newError(ErrInvalidPattern, `invalid pattern: "%s", %v`, n.getSegments(), err))
+	}
+	n.regex = re
+}
+
+// regexNesting returns the nesting depth of quantifiers in the regexp source.
+// It returns 0 for an invalid regexp and lets regexp.MustCompile report it.
+func regexNesting(regex string) int {
+	re, err := syntax.Parse(regex, syntax.Perl)
+	if err != nil {
+		return 0
+	}
+	return quantifierDepth(re)
+}
+
+// regexSpansSegments returns true if the regexp source looks like it is intended
+// to match across segments: it contains a literal "/", or an unanchored ".*" or ".+".
+func regexSpansSegments(regex string) bool {
+	re, err := syntax.Parse(regex, syntax.Perl)
+	if err != nil {
+		return false
+	}
+	var slash, dots, anchored bool
+	var scan func(re *syntax.Regexp)
+	scan = func(re *syntax.Regexp) {
+		switch re.Op {
+		case syntax.OpLiteral:
+			for _, r := range re.Rune {
+				if r == '/' {
+					slash = true
+				}
+			}
+		case syntax.OpStar, syntax.OpPlus:
+			if op := re.Sub[0].Op; op == syntax.OpAnyChar || op == syntax.OpAnyCharNotNL {
+				dots = true
+			}
+		case syntax.OpBeginText, syntax.OpEndText, syntax.OpBeginLine, syntax.OpEndLine:
+			anchored = true
+		}
+		for _, sub := range re.Sub {
+			scan(sub)
+		}
+	}
+	scan(re)
+	return slash || dots && !anchored
+}
+
+// regexNeedsDoubleSlash returns true if the regexp has a literal "//", such as
+// "https?:/{2}.+", so the paths it matches are always rewritten by FixedPathRedirect.
+func regexNeedsDoubleSlash(regex string) bool {
+	re, err := syntax.Parse(regex, syntax.Perl)
+	if err != nil {
+		return false
+	}
+	var found bool
+	var scan func(re *syntax.Regexp)
+	scan = func(re *syntax.Regexp) {
+		switch re.Op {
+		case syntax.OpLiteral:
+			found = found || strings.Contains(string(re.Rune), "//")
+		case syntax.OpConcat:
+			// "/{2}" is simplified to adjacent literals
+			var literal []rune
+			for _, sub := range re.Sub {
+				if sub.Op != syntax.OpLiteral {
+					literal = nil
+					continue
+				}
+				literal = append(literal, sub.Rune...)
+				found = found || strings.Contains(string(literal), "//")
+			}
+		}
+		for _, sub := range re.Sub {
+			scan(sub)
+		}
+	}
+	scan(re.Simplify())
+	return found
+}
+
+func quantifierDepth(re *syntax.Regexp) int {
+	depth := 0
+	for _, sub := range re.Sub {
+		if d := quantifierDepth(sub); d > depth {
+			depth = d
+		}
+	}
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		depth++
+	}
+	return depth
+}
+
+func statNode(parent *Node, depth int, stats *TrieStats) {
+	depth++
+	for _, child := range parent.getChildren() {
+		stats.NodeCount++
+		if child.endpoint {
+			stats.EndpointCount++
+		}
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+		if child.name != "" || child.anonymous {
+			stats.ParamNodes++
+		}
+		if child.wildcard {
+			stats.WildcardNodes++
+		}
+		if child.regex != nil {
+			stats.RegexNodes++
+		}
+		statNode(child, depth, stats)
+	}
+}
+
+func walkNode(parent *Node, fn func(string, *Node) bool) {
+	for _, child := range parent.getChildren() {
+		if fn(child.getSegments(), child) {
+			walkNode(child, fn)
+		}
+	}
+}
+
+// normalizePercent uppercases the hex digits of the percent-encoded sequences in
+// the path, it returns the path itself if nothing changed.
+func normalizePercent(path string) string {
+	var buf []byte
+	for i := 0; i+2 < len(path); i++ {
+		if path[i] != '%' || !isHex(path[i+1]) || !isHex(path[i+2]) {
+			continue
+		}
+		for j := i + 1; j <= i+2; j++ {
+			if c := path[j]; c >= 'a' && c <= 'f' {
+				if buf == nil {
+					buf = []byte(path)
+				}
+				buf[j] = c - 'a' + 'A'
+			}
+		}
+		i += 2
+	}
+	if buf == nil {
+		return path
+	}
+	return string(buf)
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// fixPath collapses the literal multi-slashes of the path, the percent-encoded
+// sequences such as "%2F%2F" are kept as is, so the redirect targets keep the
+// encoding of the path.
 func fixPath(path string) string {
 	if !strings.Contains(path, "//") {
 		return path
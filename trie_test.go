@@ -1,7 +1,14 @@
 package trie
 
 import (
+	"errors"
+	"net/url"
 	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -181,7 +188,7 @@ func TestGearTrieDefine(t *testing.T) {
 
 		tr1 := New()
 		assert.Panics(func() {
-			tr1.Define("/a/*")
+			tr1.Define("/a/*x")
 		})
 		assert.Panics(func() {
 			tr1.Define("/a/:*")
@@ -219,6 +226,31 @@ func TestGearTrieDefine(t *testing.T) {
 		tr1.Define("/a/bc")
 		tr1.Define("/a/b/c")
 		EqualPtr(t, node, tr1.Define("/a/:b*"))
+
+		_, line := node.DefinedAt()
+		at := " defined at trie_test.go:" + strconv.Itoa(line)
+		assert.PanicsWithError(`regex param "/a/:id([0-9]+)" conflicts with catch-all "/a/:b*"`+at, func() {
+			tr1.Define("/a/:id([0-9]+)")
+		})
+		assert.PanicsWithError(`can't define "/a/:id" after "/a/:b*"`+at, func() {
+			tr1.Define("/a/:id")
+		})
+
+		// the conflict is reported in either order of definition
+		tr2 := New()
+		id := tr2.Define("/a/:id([0-9]+)")
+		_, line = id.DefinedAt()
+		at = " defined at trie_test.go:" + strconv.Itoa(line)
+		assert.PanicsWithError(`catch-all "/a/:rest*" conflicts with regex param "/a/:id([0-9]+)"`+at, func() {
+			tr2.Define("/a/:rest*")
+		})
+		err := func() (err error) {
+			defer func() { err = recover().(error) }()
+			tr2.Define("/a/:rest*(.+)")
+			return nil
+		}()
+		assert.True(errors.Is(err, ErrPatternConflict))
+		assert.Equal(1, len(tr2.Define("/a").varyChildren))
 	})
 
 	t.Run("regexp pattern", func(t *testing.T) {
@@ -284,6 +316,41 @@ func TestGearTrieDefine(t *testing.T) {
 		})
 	})
 
+	t.Run("regexp nesting limit", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		assert.NotPanics(func() {
+			tr.Define("/c/:x((a+)+$)")
+			tr.Define(`/p/:x(^(\d{3}-)?\d{4}$)`)
+		})
+
+		tr = New(Options{MaxRegexNesting: 1})
+		assert.NotPanics(func() {
+			tr.Define(`/a/:x(^\d+$)`)
+			tr.Define(`/b/:x(^(ab)+$)`)
+		})
+		assert.PanicsWithError(`invalid pattern: "/c/:x((a+)+$)", regexp quantifiers nested deeper than 1`, func() {
+			tr.Define("/c/:x((a+)+$)")
+		})
+		assert.Panics(func() {
+			tr.Define("/c/:x((a*)?b)")
+		})
+
+		tr = New(Options{MaxRegexNesting: 2})
+		assert.NotPanics(func() {
+			tr.Define("/c/:x((a+)+$)")
+		})
+		assert.Panics(func() {
+			tr.Define("/d/:x(((a+)+)+$)")
+		})
+
+		tr = New(Options{})
+		assert.NotPanics(func() {
+			tr.Define("/d/:x(((a+)+)+$)")
+		})
+	})
+
 	t.Run("complex pattern", func(t *testing.T) {
 		assert := assert.New(t)
 
@@ -305,9 +372,8 @@ func TestGearTrieDefine(t *testing.T) {
 		assert.Panics(func() {
 			tr.Define("/a/:bb(c+)")
 		})
-		n8 := tr.Define("/a/:w*")
 		assert.Panics(func() {
-			tr.Define("/a/:b(d+)")
+			tr.Define("/a/:w*")
 		})
 
 		EqualPtr(t, p.varyChildren[0], n5)
@@ -317,7 +383,7 @@ func TestGearTrieDefine(t *testing.T) {
 		EqualPtr(t, p.varyChildren[4], n2)
 		EqualPtr(t, p.varyChildren[5], n7)
 		EqualPtr(t, p.varyChildren[6], n1)
-		EqualPtr(t, p.varyChildren[7], n8)
+		assert.Equal(7, len(p.varyChildren))
 	})
 
 	t.Run("ignoreCase option", func(t *testing.T) {
@@ -337,6 +403,373 @@ func TestGearTrieDefine(t *testing.T) {
 		node = tr.Define("/::A/b")
 		NotEqualPtr(t, node, tr.Define("/::a/b"))
 	})
+
+	t.Run("Trie Has", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/a/:id")
+		tr.Define("/a/:id/b/:x(^\\d+$)+:del")
+		tr.Define("/::raw/:path*")
+		tr.Define("/Static/x")
+		stats := tr.Stats()
+
+		assert.True(tr.Has("/a/:id"))
+		assert.True(tr.Has("a/:id"))
+		assert.False(tr.Has("/a/:other"))
+		assert.False(tr.Has("/a"))
+		assert.False(tr.Has("/a/:id/b"))
+		assert.True(tr.Has("/a/:id/b/:x(^\\d+$)+:del"))
+		assert.False(tr.Has("/a/:id/b/:x(^\\w+$)+:del"))
+		assert.False(tr.Has("/a/:id/b/:x(^\\d+$)"))
+		assert.False(tr.Has("/a/:id/b/:x+:del"))
+		assert.True(tr.Has("/::raw/:path*"))
+		assert.False(tr.Has("/::raw/:path"))
+		assert.False(tr.Has("/:raw/:path*"))
+		assert.True(tr.Has("/static/X"))
+		assert.False(tr.Has("/a//:id"))
+		assert.False(tr.Has("/x/y/z"))
+		assert.Equal(stats, tr.Stats())
+	})
+
+	t.Run("CaseCollisions method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		assert.Equal(0, len(tr.CaseCollisions()))
+
+		node := tr.Define("/api/users")
+		EqualPtr(t, node, tr.Define("/API/users"))
+		assert.Equal([][2]string{{"/api", "/API"}}, tr.CaseCollisions())
+
+		tr.Define("/API/users")
+		tr.Define("/API/teams")
+		tr.Define("/api/users")
+		tr.Define("/api/:Users")
+		assert.Equal([][2]string{{"/api", "/API"}}, tr.CaseCollisions())
+
+		tr.Define("/api/Users/::Me")
+		tr.Define("/api/users/::me")
+		assert.Equal([][2]string{{"/api", "/API"}, {"/api/users", "/api/Users"}, {"/api/users/::Me", "/api/users/::me"}}, tr.CaseCollisions())
+
+		tr = New(Options{})
+		tr.Define("/api")
+		tr.Define("/API")
+		assert.Equal(0, len(tr.CaseCollisions()))
+	})
+
+	t.Run("Options method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal(Options{}, New(Options{}).Options())
+		assert.Equal(defaultOptions, New().Options())
+		assert.True(New().Options().IgnoreCase)
+		assert.True(New().Options().FixedPathRedirect)
+		assert.True(New().Options().TrailingSlashRedirect)
+
+		opts := Options{
+			IgnoreCase:           true,
+			IgnoreMethodCase:     true,
+			MaxRegexNesting:      2,
+			WildcardLeadingSlash: true,
+			AnonymousParams:      true,
+			MaxParams:            3,
+			RPCMethods:           []string{"CALL"},
+			RegexFlags:           "i",
+		}
+		tr := New(opts)
+		assert.Equal(opts, tr.Options())
+
+		tr.Options().RPCMethods[0] = "CAST"
+		assert.Equal([]string{"CALL"}, tr.Options().RPCMethods)
+	})
+
+	t.Run("Options.ParamNameRegex", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Panics(func() {
+			New().Define("/users/:user-id")
+		})
+
+		tr := New(Options{ParamNameRegex: regexp.MustCompile(`^[\w.-]+$`)})
+		user := tr.Define("/users/:user-id")
+		file := tr.Define("/files/:file.ext(^[a-z]+$)+.json")
+		all := tr.Define("/static/:file-path*")
+
+		res := tr.Match("/users/123")
+		EqualPtr(t, user, res.Node)
+		assert.Equal("123", res.Params["user-id"])
+
+		res = tr.Match("/files/abc.json")
+		EqualPtr(t, file, res.Node)
+		assert.Equal("abc", res.Params["file.ext"])
+
+		res = tr.Match("/static/a/b")
+		EqualPtr(t, all, res.Node)
+		assert.Equal("a/b", res.Params["file-path"])
+
+		assert.True(tr.Has("/users/:user-id"))
+		assert.Panics(func() {
+			tr.Define("/x/:a b")
+		})
+	})
+
+	t.Run("Warnings for FixedPathRedirect on catch-all", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/a/")
+		tr.Define("/files/:path*")
+		tr.Define("/docs/:path*([a-z/]+)")
+		assert.Equal(0, len(tr.Warnings()))
+
+		tr.Define("/proxy/:url*(https?:/{2}.+)")
+		tr.Define("/proxy/:url*(https?:/{2}.+)")
+		tr.Define(`/mirror/:url*(^[a-z]+:\/\/.+$)`)
+		assert.Equal(2, len(tr.Warnings()))
+		assert.Contains(tr.Warnings()[0], `"/proxy/:url*(https?:/{2}.+)"`)
+		assert.Contains(tr.Warnings()[0], "FixedPathRedirect")
+		assert.Contains(tr.Warnings()[1], `"/mirror/:url*`)
+
+		// the fixed path doesn't match the regexp either
+		res := tr.Match("/proxy/http://example.com")
+		assert.Nil(res.Node)
+		assert.Equal("", res.FPR)
+		res = tr.Match("/files/http://example.com")
+		assert.Equal("/files/http:/example.com", res.FPR)
+
+		tr = New(Options{})
+		tr.Define("/proxy/:url*(https?:/{2}.+)")
+		assert.Equal(0, len(tr.Warnings()))
+		assert.Equal("http://example.com", tr.Match("/proxy/http://example.com").Params["url"])
+	})
+
+	t.Run("Warnings for regexp params spanning segments", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{})
+		tr.Define("/a/:path(.*/.*)")
+		assert.Equal(1, len(tr.Warnings()))
+		assert.Contains(tr.Warnings()[0], `"/a/:path(.*/.*)"`)
+		assert.Contains(tr.Warnings()[0], ":path*(regexp)")
+		assert.Nil(tr.Match("/a/b/c").Node)
+
+		tr.Define("/b/:path(.+)")
+		tr.Define("/c/:file(^[a-z]+/[a-z]+$)")
+		assert.Equal(3, len(tr.Warnings()))
+
+		tr.Define("/d/:id(^\\d+$)")
+		tr.Define("/e/:name(^.+$)")
+		tr.Define("/f/:name([a-z]+)")
+		tr.Define("/g/:path*(.*/.*)")
+		assert.True(tr.Has("/a/:path(.*/.*)"))
+		assert.Equal(3, len(tr.Warnings()))
+	})
+
+	t.Run("glob segments", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{})
+		meta := tr.Define("/files/*/meta")
+		res := tr.Match("/files/a/meta")
+		EqualPtr(t, meta, res.Node)
+		assert.Equal([]string{"a"}, res.Positional)
+		assert.Nil(res.Params)
+		assert.Equal("/files/*/meta", res.Pattern)
+		assert.Nil(tr.Match("/files/a/b/meta").Node)
+		assert.Nil(tr.Match("/files/a").Node)
+
+		all := New(Options{}).Define("/files/**")
+		res = all.trie.Match("/files/a/b/c")
+		EqualPtr(t, all, res.Node)
+		assert.Equal([]string{"a/b/c"}, res.Positional)
+		assert.Equal("/files/**", res.Pattern)
+
+		assert.True(meta.parent.anonymous)
+		assert.False(meta.parent.wildcard)
+		assert.True(all.anonymous)
+		assert.True(all.wildcard)
+
+		tr = New(Options{AnonymousParams: true})
+		EqualPtr(t, tr.Define("/a/*"), tr.Define("/a/:"))
+		EqualPtr(t, tr.Define("/b/**"), tr.Define("/b/:*"))
+
+		assert.Panics(func() { tr.Define("/a/:name") })
+		assert.Panics(func() { tr.Define("/b/**/c") })
+		assert.Panics(func() { tr.Define("/c/***") })
+		assert.Panics(func() { tr.Define("/c/*.txt") })
+	})
+
+	t.Run("Trie.Freeze", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/a/:id")
+		node.Handle("GET", "a")
+		assert.False(tr.Frozen())
+		tr.Freeze()
+		assert.True(tr.Frozen())
+
+		assert.PanicsWithError("trie is frozen", func() { tr.Define("/b") })
+		err := panicError(func() { tr.Define("/a/:id") })
+		assert.True(errors.Is(err, ErrFrozen))
+		for _, fn := range []func(){
+			func() { tr.Route("GET", "/b", "b") },
+			func() { tr.Use("mw") },
+			func() { tr.SetNotFound("404") },
+			func() { node.Define("/b") },
+			func() { node.Handle("PUT", "a") },
+			func() { node.Remove("GET") },
+			func() { node.HandleSubtree("GET", "a") },
+			func() { node.SetDefault("id", "1") },
+			func() { node.Priority(1) },
+			func() { node.Validate(func(string) bool { return true }) },
+		} {
+			assert.True(errors.Is(panicError(fn), ErrFrozen))
+		}
+
+		err = tr.LoadFrom(strings.NewReader("GET /c"), func(method, pattern string) interface{} {
+			return method
+		})
+		assert.True(errors.Is(err, ErrFrozen))
+		assert.True(errors.Is(tr.Merge(New(), nil), ErrFrozen))
+
+		res := tr.Match("/a/1")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("a", res.Handler("GET"))
+		assert.Nil(tr.Match("/b").Node)
+		assert.Equal("GET", node.GetAllow())
+	})
+
+	t.Run("Trie.OnDefine", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		var patterns []string
+		var nodes []*Node
+		tr.OnDefine(func(pattern string, n *Node) {
+			patterns = append(patterns, pattern)
+			nodes = append(nodes, n)
+		})
+		tr.OnDefine(func(pattern string, n *Node) {
+			patterns = append(patterns, "2 "+pattern)
+		})
+
+		a := tr.Define("/a/:id")
+		assert.Equal([]string{"/a/:id", "2 /a/:id"}, patterns)
+		EqualPtr(t, a, nodes[0])
+
+		tr.Route("GET", "/b", "b")
+		b := a.Define("/c")
+		tr.Define("/a/:id")
+		assert.Equal([]string{
+			"/a/:id", "2 /a/:id",
+			"/b", "2 /b",
+			"/a/:id/c", "2 /a/:id/c",
+			"/a/:id", "2 /a/:id",
+		}, patterns)
+		EqualPtr(t, b, nodes[2])
+		EqualPtr(t, a, nodes[3])
+
+		patterns = nil
+		assert.Panics(func() { tr.Define("/a/:name") })
+		assert.Panics(func() { tr.Define("/a//b") })
+		assert.Nil(patterns)
+	})
+
+	t.Run("Trie.RemoveSubtree", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Route("GET", "/plugin", "plugin")
+		tr.Route("GET", "/plugin/a", "a")
+		tr.Route("GET", "/plugin/:id/b", "b")
+		tr.Define("/plugin/:id/c/:path*")
+		tr.Route("GET", "/other/a", "other")
+		assert.Equal(4, tr.Len())
+
+		assert.Equal(4, tr.RemoveSubtree("/plugin"))
+		for _, path := range []string{"/plugin", "/plugin/a", "/plugin/1/b", "/plugin/1/c/x/y"} {
+			assert.Nil(tr.Match(path).Node)
+		}
+		assert.False(tr.Has("/plugin/a"))
+		assert.NotNil(tr.Match("/other/a").Node)
+		assert.Equal(1, tr.Len())
+		assert.Equal(0, tr.RemoveSubtree("/plugin"))
+		assert.Equal(0, tr.RemoveSubtree("/none"))
+
+		// param and catch-all prefixes
+		tr.Define("/users/:id/posts")
+		tr.Define("/users/:id")
+		tr.Define("/users/:id(^[0-9]+$)/x")
+		tr.Define("/files/:path*")
+		assert.Equal(0, tr.RemoveSubtree("/users/:other"))
+		assert.Equal(2, tr.RemoveSubtree("/users/:id"))
+		assert.Nil(tr.Match("/users/a/posts").Node)
+		assert.NotNil(tr.Match("/users/1/x").Node)
+		assert.Equal(1, len(tr.Define("/users").varyChildren))
+		assert.Equal(1, tr.RemoveSubtree("/files/:path*"))
+		assert.Nil(tr.Match("/files/a").Node)
+		assert.Equal(0, len(tr.Define("/files").varyChildren))
+
+		// defining the prefix again creates new nodes
+		tr.Route("GET", "/plugin/a", "a2")
+		assert.Equal("a2", tr.Match("/plugin/a").Handler("GET"))
+		assert.Equal(2, tr.Len())
+	})
+
+	t.Run("pattern without leading slash", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("users")
+		EqualPtr(t, node, tr.Define("/users"))
+		assert.Equal("/users", node.GetPattern())
+
+		node = tr.Define("users/:id")
+		EqualPtr(t, node, tr.Define("/users/:id"))
+		assert.Equal("/users/:id", node.GetPattern())
+		assert.Equal("42", tr.Match("/users/42").Params["id"])
+
+		var patterns []string
+		tr.OnDefine(func(pattern string, _ *Node) {
+			patterns = append(patterns, pattern)
+		})
+		tr.Define("posts")
+		assert.Equal([]string{"/posts"}, patterns)
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/a/b/c/d")
+		tr.Define("/a/:x/e")
+		tr.Define("/keep/f").HandleSubtree("GET", "fallback")
+		tr.Define("/keep/f/g")
+		tr.Define("/h")
+		assert.Equal(0, tr.Compact())
+		assert.Equal(10, tr.Stats().NodeCount)
+
+		assert.Equal(1, tr.RemoveSubtree("/a/b/c/d"))
+		assert.Equal(1, tr.RemoveSubtree("/a/:x/e"))
+		assert.Equal(1, tr.RemoveSubtree("/keep/f/g"))
+		assert.Equal(7, tr.Stats().NodeCount)
+
+		// "/a/b/c", "/a/b", "/a/:x" and "/a" are left without a purpose
+		assert.Equal(4, tr.Compact())
+		assert.Equal(3, tr.Stats().NodeCount)
+		assert.Equal(0, tr.Compact())
+		assert.False(tr.Has("/a"))
+		assert.True(tr.Has("/keep/f"))
+		assert.NotNil(tr.Match("/h").Node)
+		assert.Equal("fallback", tr.Match("/keep/f").Handler("GET"))
+
+		tr.Freeze()
+		assert.Panics(func() {
+			tr.Compact()
+		})
+	})
 }
 
 func TestGearTrieMatch(t *testing.T) {
@@ -464,6 +897,30 @@ func TestGearTrieMatch(t *testing.T) {
 		EqualPtr(t, node, res.Node)
 	})
 
+	t.Run("WildcardLeadingSlash option", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{WildcardLeadingSlash: true})
+		node := tr.Define("/proxy/:rest*")
+		res := tr.Match("/proxy/foo/bar")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("/foo/bar", res.Params["rest"])
+		res = tr.Match("/proxy/")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("/", res.Params["rest"])
+		assert.Nil(tr.Match("/proxy").Node)
+
+		tr = New(Options{WildcardLeadingSlash: false})
+		node = tr.Define("/proxy/:rest*")
+		res = tr.Match("/proxy/foo/bar")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("foo/bar", res.Params["rest"])
+		res = tr.Match("/proxy/")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("", res.Params["rest"])
+		assert.Nil(tr.Match("/proxy").Node)
+	})
+
 	t.Run("regexp pattern", func(t *testing.T) {
 		assert := assert.New(t)
 
@@ -693,33 +1150,2621 @@ func TestGearTrieMatch(t *testing.T) {
 		assert.Equal("", tr.Match("/abc//xyz").TSR)
 		assert.Equal("/abc/xyz/", tr.Match("/abc//xyz").FPR)
 	})
-}
+	t.Run("MatchedDepth and LastNode", func(t *testing.T) {
+		assert := assert.New(t)
 
-func TestGearTrieNode(t *testing.T) {
-	t.Run("Node Handle", func(t *testing.T) {
+		tr := New()
+		node := tr.Define("/api/users/list")
+		tr.Define("/api/users/:id(^\\d+$)")
+
+		res := tr.Match("/api/users/list")
+		EqualPtr(t, node, res.Node)
+		EqualPtr(t, node, res.LastNode)
+		assert.Equal(3, res.MatchedDepth)
+
+		res = tr.Match("/api/users/lst")
+		assert.Nil(res.Node)
+		EqualPtr(t, tr.Define("/api/users"), res.LastNode)
+		assert.Equal(2, res.MatchedDepth)
+
+		res = tr.Match("/api/usrs/list")
+		assert.Nil(res.Node)
+		EqualPtr(t, tr.Define("/api"), res.LastNode)
+		assert.Equal(1, res.MatchedDepth)
+
+		res = tr.Match("/x")
+		assert.Nil(res.LastNode)
+		assert.Equal(0, res.MatchedDepth)
+	})
+	t.Run("Found and RedirectTarget", func(t *testing.T) {
 		assert := assert.New(t)
 
-		handler := func() {}
 		tr := New()
-		tr.Define("/").Handle("GET", handler)
-		tr.Define("/").Handle("PUT", handler)
-		tr.Define("/api").Handle("GET", handler)
+		tr.Define("/abc/efg")
+		tr.Define("/abc/xyz/")
+
+		res := tr.Match("/abc/efg")
+		assert.True(res.Found())
+		path, ok := res.RedirectTarget()
+		assert.False(ok)
+		assert.Equal("", path)
+
+		res = tr.Match("/abc/efg/")
+		assert.False(res.Found())
+		path, ok = res.RedirectTarget()
+		assert.True(ok)
+		assert.Equal("/abc/efg", path)
+
+		res = tr.Match("/abc//efg")
+		assert.False(res.Found())
+		path, ok = res.RedirectTarget()
+		assert.True(ok)
+		assert.Equal("/abc/efg", path)
+
+		res = tr.Match("/abc//xyz")
+		assert.False(res.Found())
+		path, ok = res.RedirectTarget()
+		assert.True(ok)
+		assert.Equal("/abc/xyz/", path)
+
+		res = tr.Match("/abc/none")
+		assert.False(res.Found())
+		path, ok = res.RedirectTarget()
+		assert.False(ok)
+		assert.Equal("", path)
+	})
+
+	t.Run("MatchQuery with query constraints", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/search")
+		node.RequireQuery("type", "^image$")
+		plain := tr.Define("/plain")
 
+		res := tr.MatchQuery("/search", url.Values{"type": {"image"}})
+		EqualPtr(t, node, res.Node)
+		res = tr.MatchQuery("/search", url.Values{"type": {"video", "image"}})
+		EqualPtr(t, node, res.Node)
+		res = tr.MatchQuery("/search", url.Values{"type": {"video"}})
+		assert.Nil(res.Node)
+		res = tr.MatchQuery("/search", url.Values{})
+		assert.Nil(res.Node)
+		EqualPtr(t, node, tr.Match("/search").Node)
+
+		node.RequireQuery("q", ".")
+		assert.Nil(tr.MatchQuery("/search", url.Values{"type": {"image"}}).Node)
+		EqualPtr(t, node, tr.MatchQuery("/search", url.Values{"type": {"image"}, "q": {"go"}}).Node)
+
+		EqualPtr(t, plain, tr.MatchQuery("/plain", nil).Node)
+		assert.Equal("/search", tr.MatchQuery("/search/", nil).TSR)
+	})
+
+	t.Run("Matched Pattern", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/users/:id")
+		tr.Define("/files/:path*")
+
+		assert.Equal("/users/:id", tr.Match("/users/42").Pattern)
+		assert.Equal("/files/:path*", tr.Match("/files/a/b").Pattern)
+		assert.Equal("", tr.Match("/users").Pattern)
+		assert.Equal("", tr.Match("/users//42").Pattern)
+		assert.Equal("", tr.Match("/users/42/").Pattern)
+	})
+
+	t.Run("AnonymousParams option", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
 		assert.Panics(func() {
-			tr.Define("/").Handle("GET", handler)
+			tr.Define("/a/:")
 		})
 		assert.Panics(func() {
-			tr.Define("/").Handle("PUT", handler)
+			tr.Define("/a/:(x)")
 		})
+
+		tr = New(Options{AnonymousParams: true})
+		node := tr.Define("/:/comments/:id")
+		res := tr.Match("/123/comments/456")
+		EqualPtr(t, node, res.Node)
+		assert.Equal([]string{"123"}, res.Positional)
+		assert.Equal(map[string]string{"id": "456"}, res.Params)
 		assert.Panics(func() {
-			tr.Define("/api").Handle("GET", handler)
+			tr.Define("/:name/comments")
 		})
 
-		EqualPtr(t, handler, tr.Match("/").Node.GetHandler("GET").(func()))
-		EqualPtr(t, handler, tr.Match("/").Node.GetHandler("PUT").(func()))
-		assert.Equal("GET, PUT", tr.Match("/").Node.GetAllow())
+		node = tr.Define("/a/:(^\\d+$)/:+:del/:*")
+		res = tr.Match("/a/1/x:del/y/z")
+		EqualPtr(t, node, res.Node)
+		assert.Equal([]string{"1", "x", "y/z"}, res.Positional)
+		assert.Nil(res.Params)
+		assert.Nil(tr.Match("/a/x/x:del/y/z").Node)
+		assert.Equal(5, tr.Stats().ParamNodes)
+	})
 
-		EqualPtr(t, handler, tr.Match("/api").Node.GetHandler("GET").(func()))
-		assert.Equal("GET", tr.Match("/api").Node.GetAllow())
+	t.Run("MatchSegments", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{IgnoreCase: true, TrailingSlashRedirect: true, AnonymousParams: true})
+		tr.Define("/")
+		tr.Define("/a/b")
+		tr.Define("/a/:id/:+:del")
+		tr.Define("/files/:path*")
+		tr.Define("/x/")
+
+		for _, path := range []string{"/", "/a/b", "/A/B", "/a/c/x:del", "/files/a/b/c", "/x/", "/a/x", "/x"} {
+			res := tr.MatchSegments(strings.Split(path[1:], "/"))
+			expected := tr.Match(path)
+			assert.Equal(expected.Node, res.Node, path)
+			assert.Equal(expected.Params, res.Params, path)
+			assert.Equal(expected.Positional, res.Positional, path)
+			assert.Equal(expected.Pattern, res.Pattern, path)
+			assert.Equal(expected.MatchedDepth, res.MatchedDepth, path)
+			assert.Equal("", res.TSR)
+			assert.Equal("", res.FPR)
+		}
+
+		res := tr.MatchSegments([]string{"a", "b"})
+		EqualPtr(t, tr.Define("/a/b"), res.Node)
+		assert.Nil(tr.MatchSegments(nil).Node)
+		assert.Equal("", tr.MatchSegments([]string{"x"}).TSR)
+		assert.Equal("/x/", tr.Match("/x").TSR)
+	})
+
+	t.Run("Node Validate", func(t *testing.T) {
+		assert := assert.New(t)
+
+		countries := map[string]bool{"us": true, "cn": true}
+		tr := New()
+		country := tr.Define("/country/:code")
+		country.Validate(func(code string) bool {
+			return countries[code]
+		})
+		res := tr.Match("/country/cn")
+		EqualPtr(t, country, res.Node)
+		assert.Equal("cn", res.Params["code"])
+		assert.Nil(tr.Match("/country/zz").Node)
+
+		code := tr.Define("/x/:code(^[a-z]{2}$)")
+		code.Validate(func(code string) bool {
+			return countries[code]
+		})
+		name := tr.Define("/x/:name")
+		EqualPtr(t, code, tr.Match("/x/us").Node)
+		res = tr.Match("/x/zz")
+		EqualPtr(t, name, res.Node)
+		assert.Equal("zz", res.Params["name"])
+
+		files := tr.Define("/files/:path*")
+		files.Validate(func(path string) bool {
+			return !strings.Contains(path, "..")
+		})
+		files.Validate(func(path string) bool {
+			return path != "secret"
+		})
+		assert.Equal("a/b", tr.Match("/files/a/b").Params["path"])
+		assert.Nil(tr.Match("/files/a/../b").Node)
+		assert.Nil(tr.Match("/files/secret").Node)
+		assert.Nil(tr.MatchSegments([]string{"files", "a", "..", "b"}).Node)
+	})
+
+	t.Run("Node Literal", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/static").Literal()
+		weird := tr.Define("/static/:weird")
+		escaped := tr.Define("/static/::a/*/(x)")
+		param := tr.Define("/other/:weird")
+
+		assert.Equal("", weird.name)
+		assert.Equal(0, len(tr.Define("/static").varyChildren))
+		res := tr.Match("/static/:weird")
+		EqualPtr(t, weird, res.Node)
+		assert.Nil(res.Params)
+		assert.Nil(tr.Match("/static/x").Node)
+		EqualPtr(t, escaped, tr.Match("/static/::a/*/(x)").Node)
+		assert.Nil(tr.Match("/static/:a/*/(x)").Node)
+		EqualPtr(t, weird, tr.Match("/static/:WEIRD").Node)
+
+		res = tr.Match("/other/x")
+		EqualPtr(t, param, res.Node)
+		assert.Equal("x", res.Params["weird"])
+
+		assert.True(tr.Has("/static/:weird"))
+		assert.True(tr.Has("/static/::a/*/(x)"))
+		assert.False(tr.Has("/static/:a"))
+	})
+
+	t.Run("MaxParams option", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{MaxParams: 2, AnonymousParams: true})
+		tr.Define("/:a/:b")
+		tr.Define("/:a/:b/:c")
+		tr.Define("/:a/:b/x/:rest*")
+		tr.Define("/:a/:b/y/:")
+
+		res := tr.Match("/1/2")
+		assert.NotNil(res.Node)
+		assert.Equal(map[string]string{"a": "1", "b": "2"}, res.Params)
+
+		res = tr.Match("/1/2/3")
+		assert.Equal(&Matched{}, res)
+		assert.Equal(&Matched{}, tr.Match("/1/2/x/y/z"))
+		assert.Equal(&Matched{}, tr.Match("/1/2/y/z"))
+		assert.Equal(&Matched{}, tr.MatchSegments([]string{"1", "2", "3"}))
+
+		tr = New(Options{})
+		tr.Define("/:a/:b/:c")
+		assert.NotNil(tr.Match("/1/2/3").Node)
+	})
+
+	t.Run("trailing slash variants coexist", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		collection := tr.Route("GET", "/foo", "collection")
+		index := tr.Route("GET", "/foo/", "index")
+		NotEqualPtr(t, collection, index)
+
+		res := tr.Match("/foo")
+		EqualPtr(t, collection, res.Node)
+		assert.Equal("collection", res.Handler("GET"))
+		assert.Equal("", res.TSR)
+		assert.Equal("", res.FPR)
+
+		res = tr.Match("/foo/")
+		EqualPtr(t, index, res.Node)
+		assert.Equal("index", res.Handler("GET"))
+		assert.Equal("", res.TSR)
+		assert.Equal("", res.FPR)
+
+		res = tr.Match("/foo//")
+		assert.Nil(res.Node)
+		assert.Equal("", res.TSR)
+		assert.Equal("/foo/", res.FPR)
+
+		tr.Route("GET", "/bar/:id", "bar")
+		tr.Route("GET", "/bar/:id/", "bar index")
+		assert.Equal("bar", tr.Match("/bar/1").Handler("GET"))
+		assert.Equal("", tr.Match("/bar/1").TSR)
+		assert.Equal("bar index", tr.Match("/bar/1/").Handler("GET"))
+		assert.Equal("", tr.Match("/bar/1/").TSR)
+	})
+
+	t.Run("Matched.ParamsCopy method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/users/:user/repos/:repo")
+
+		res := tr.Match("/users/tom/repos/trie")
+		params := res.ParamsCopy()
+		assert.Equal(map[string]string{"user": "tom", "repo": "trie"}, params)
+
+		params["user"] = "jerry"
+		assert.Equal("tom", res.Params["user"])
+
+		// simulate reusing the Matched
+		res.Params["user"] = "spike"
+		delete(res.Params, "repo")
+		assert.Equal(map[string]string{"user": "jerry", "repo": "trie"}, params)
+
+		params = new(Matched).ParamsCopy()
+		assert.NotNil(params)
+		assert.Equal(0, len(params))
+	})
+
+	t.Run("bracketed literal segments", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		status := tr.Define("/[::1]/status")
+		param := tr.Define("/[:id]/:name")
+		regex := tr.Define("/hosts/[(a|b)]")
+
+		res := tr.Match("/[::1]/status")
+		EqualPtr(t, status, res.Node)
+		assert.Equal(0, len(res.Params))
+		assert.Equal("/[::1]/status", res.Pattern)
+
+		assert.Nil(tr.Match("/[:1]/status").Node)
+		assert.Nil(tr.Match("/::1/status").Node)
+
+		res = tr.Match("/[:id]/tom")
+		EqualPtr(t, param, res.Node)
+		assert.Equal(map[string]string{"name": "tom"}, res.Params)
+		assert.Nil(tr.Match("/123/tom").Node)
+
+		EqualPtr(t, regex, tr.Match("/hosts/[(a|b)]").Node)
+		assert.Nil(tr.Match("/hosts/a").Node)
+	})
+
+	t.Run("static only trie matches like generic trie", func(t *testing.T) {
+		assert := assert.New(t)
+
+		routes := []string{"/", "/a/b", "/a/b/c/", "/Users/::name", "/x"}
+		static := New(Options{IgnoreCase: true, FixedPathRedirect: true, TrailingSlashRedirect: true})
+		generic := New(Options{IgnoreCase: true, FixedPathRedirect: true, TrailingSlashRedirect: true})
+		for _, route := range routes {
+			static.Define(route)
+			generic.Define(route)
+		}
+		generic.Define("/generic/:id")
+		assert.True(static.staticOnly)
+		assert.False(generic.staticOnly)
+
+		for _, path := range []string{"/", "/a", "/a/b", "/a/b/", "/A/B", "/a/b/c", "/a/b/c/",
+			"/a//b", "/a/./b/c", "/users/:name", "/users/:name/", "/x/y", "//x"} {
+			res, expected := static.Match(path), generic.Match(path)
+			assert.Equal(expected.Pattern, res.Pattern, path)
+			assert.Equal(expected.TSR, res.TSR, path)
+			assert.Equal(expected.FPR, res.FPR, path)
+			assert.Equal(expected.MatchedDepth, res.MatchedDepth, path)
+			assert.Equal(expected.Node == nil, res.Node == nil, path)
+		}
+	})
+
+	t.Run("MatchRPC method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/users/:id")
+		root := tr.Define("/")
+
+		method, res := tr.MatchRPC("/GET/users/42")
+		assert.Equal("GET", method)
+		EqualPtr(t, node, res.Node)
+		assert.Equal("/users/:id", res.Pattern)
+		assert.Equal("42", res.Params["id"])
+
+		method, res = tr.MatchRPC("/DELETE")
+		assert.Equal("DELETE", method)
+		EqualPtr(t, root, res.Node)
+
+		method, res = tr.MatchRPC("/GET/users/42/")
+		assert.Equal("GET", method)
+		assert.Nil(res.Node)
+		assert.Equal("/users/42", res.TSR)
+
+		method, res = tr.MatchRPC("/FETCH/users/42")
+		assert.Equal("", method)
+		assert.Nil(res.Node)
+
+		method, res = tr.MatchRPC("/get/users/42")
+		assert.Equal("", method)
+		assert.Nil(res.Node)
+
+		assert.Panics(func() {
+			tr.MatchRPC("GET/users/42")
+		})
+
+		tr = New(Options{IgnoreMethodCase: true, RPCMethods: []string{"call", "cast"}})
+		tr.Define("/users/:id")
+		method, res = tr.MatchRPC("/Call/users/42")
+		assert.Equal("CALL", method)
+		assert.Equal("42", res.Params["id"])
+		method, _ = tr.MatchRPC("/GET/users/42")
+		assert.Equal("", method)
+	})
+
+	t.Run("Options.CaseFold", func(t *testing.T) {
+		assert := assert.New(t)
+
+		asciiFold := func(s string) string {
+			b := []byte(s)
+			for i, c := range b {
+				if 'A' <= c && c <= 'Z' {
+					b[i] = c + 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+
+		tr := New(Options{IgnoreCase: true, CaseFold: asciiFold})
+		node := tr.Define("/Users/ÄBC")
+		EqualPtr(t, node, tr.Define("/users/ÄBC"))
+		EqualPtr(t, node, tr.Match("/USERS/ÄBC").Node)
+		EqualPtr(t, node, tr.Match("/users/Äbc").Node)
+		assert.Nil(tr.Match("/users/äbc").Node)
+
+		param := tr.Define("/Users/:name/Repos")
+		res := tr.Match("/users/TOM/REPOS")
+		EqualPtr(t, param, res.Node)
+		assert.Equal("TOM", res.Params["name"])
+
+		tr = New(Options{IgnoreCase: true})
+		node = tr.Define("/users/ÄBC")
+		EqualPtr(t, node, tr.Match("/users/äbc").Node)
+
+		tr = New(Options{CaseFold: asciiFold})
+		tr.Define("/users")
+		assert.Nil(tr.Match("/Users").Node)
+	})
+
+	t.Run("endpoint takes precedence over redirects", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cases := []struct {
+			routes   []string
+			path     string
+			pattern  string
+			tsr, fpr string
+			noFPR    bool
+		}{
+			{[]string{"/foo"}, "/foo", "/foo", "", "", false},
+			{[]string{"/foo"}, "/foo/", "", "/foo", "", false},
+			{[]string{"/foo/"}, "/foo", "", "/foo/", "", false},
+			{[]string{"/foo", "/foo/"}, "/foo", "/foo", "", "", false},
+			{[]string{"/foo", "/foo/"}, "/foo/", "/foo/", "", "", false},
+			{[]string{"/foo", "/foo/"}, "/foo//", "", "", "/foo/", false},
+			{[]string{"/foo", "/foo/"}, "//foo", "", "", "/foo", false},
+			{[]string{"/foo"}, "//foo/", "", "", "/foo", false},
+			{[]string{"/foo/"}, "//foo", "", "", "/foo/", false},
+			{[]string{"/foo", "/foo/"}, "/foo//", "", "/foo/", "", true},
+			{[]string{"/foo"}, "//foo", "", "", "", true},
+			{[]string{"/foo/:id", "/foo/:id/"}, "/foo/1/", "/foo/:id/", "", "", false},
+			{[]string{"/foo/:path*"}, "/foo/", "/foo/:path*", "", "", false},
+		}
+		for _, c := range cases {
+			tr := New(Options{TrailingSlashRedirect: true, FixedPathRedirect: !c.noFPR})
+			for _, route := range c.routes {
+				tr.Define(route)
+			}
+			res := tr.Match(c.path)
+			assert.Equal(c.pattern, res.Pattern, c.path)
+			assert.Equal(c.pattern != "", res.Node != nil, c.path)
+			assert.Equal(c.tsr, res.TSR, c.path)
+			assert.Equal(c.fpr, res.FPR, c.path)
+			if res.Node != nil {
+				_, ok := res.RedirectTarget()
+				assert.False(ok, c.path)
+			}
+		}
+	})
+
+	t.Run("catch-all param with regexp", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{})
+		version := tr.Define("/docs/v1")
+		docs := tr.Define("/docs/:path*([a-z0-9/._-]+)")
+		EqualPtr(t, docs, tr.Define("/docs/:path*([a-z0-9/._-]+)"))
+		assert.Equal(1, len(tr.Define("/docs").varyChildren))
+
+		res := tr.Match("/docs/guide/intro.md")
+		EqualPtr(t, docs, res.Node)
+		assert.True(tr.Has("/docs/:path*([a-z0-9/._-]+)"))
+		assert.Equal("guide/intro.md", res.Params["path"])
+		assert.Equal("/docs/:path*([a-z0-9/._-]+)", res.Pattern)
+
+		assert.Nil(tr.Match("/docs/Guide/intro.md").Node)
+		assert.Nil(tr.Match("/docs/guide/%00").Node)
+		assert.Nil(tr.Match("/docs/").Node)
+
+		EqualPtr(t, version, tr.Match("/docs/v1").Node)
+		EqualPtr(t, docs, tr.Match("/docs/v1x").Node)
+		EqualPtr(t, docs, tr.Match("/docs/guide").Node)
+		assert.Nil(tr.Match("/docs/Guide").Node)
+
+		tr = New(Options{WildcardLeadingSlash: true})
+		v := tr.Define("/v/:rest*(/[0-9]+(\\.[0-9]+)*)")
+		assert.Equal("/1.2.3", tr.Match("/v/1.2.3").Params["rest"])
+		EqualPtr(t, v, tr.Match("/v/1.2").Node)
+		assert.Nil(tr.Match("/v/1.x").Node)
+		res = tr.MatchSegments([]string{"v", "1.2"})
+		EqualPtr(t, v, res.Node)
+
+		assert.Panics(func() {
+			tr.Define("/v/:rest*")
+		})
+		assert.Panics(func() {
+			tr.Define("/v/:rest*([a-z]+)")
+		})
+		assert.Panics(func() {
+			tr.Define("/v/:other*(/[0-9]+(\\.[0-9]+)*)")
+		})
+		assert.Panics(func() {
+			New().Define("/v/:rest*()")
+		})
+		assert.Panics(func() {
+			New().Define("/v/:rest*([a-)")
+		})
+		assert.Panics(func() {
+			New(Options{MaxRegexNesting: 1}).Define("/v/:rest*((a+)+)")
+		})
+		assert.Panics(func() {
+			New().Define("/v/:rest*([a-z]+)/x")
+		})
+	})
+
+	t.Run("Options.RegexFlags", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{})
+		tr.Define("/country/:code(^[a-z]+$)")
+		assert.Nil(tr.Match("/country/ABC").Node)
+
+		tr = New(Options{RegexFlags: "i"})
+		node := tr.Define("/country/:code(^[a-z]+$)")
+		res := tr.Match("/country/ABC")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("ABC", res.Params["code"])
+		assert.Nil(tr.Match("/country/A1").Node)
+
+		// inline flags take precedence
+		node = tr.Define("/lang/:code(^(?-i)[a-z]+$)")
+		EqualPtr(t, node, tr.Match("/lang/en").Node)
+		assert.Nil(tr.Match("/lang/EN").Node)
+
+		node = tr.Define("/docs/:path*([a-z/]+)")
+		EqualPtr(t, node, tr.Match("/docs/A/b").Node)
+
+		tr = New(Options{IgnoreCase: true})
+		node = tr.Define("/country/:code(^[a-z]+$)")
+		res = tr.Match("/country/ABC")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("ABC", res.Params["code"])
+
+		assert.Panics(func() {
+			New(Options{RegexFlags: "x"}).Define("/country/:code(^[a-z]+$)")
+		})
+	})
+
+	t.Run("escaped static segments", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		emoji := tr.Define(`/emoji/\(o_o\)`)
+		star := tr.Define(`/\*`)
+		colon := tr.Define(`/\:id/\\`)
+		literal := tr.Define(`/\(literal)`)
+
+		res := tr.Match("/emoji/(o_o)")
+		EqualPtr(t, emoji, res.Node)
+		assert.Equal(`/emoji/\(o_o\)`, res.Pattern)
+		assert.Equal(0, len(res.Params))
+		assert.Nil(tr.Match(`/emoji/\(o_o\)`).Node)
+
+		EqualPtr(t, star, tr.Match("/*").Node)
+		EqualPtr(t, colon, tr.Match(`/:id/\`).Node)
+		assert.Nil(tr.Match("/123/\\").Node)
+		EqualPtr(t, literal, tr.Match("/(literal)").Node)
+		EqualPtr(t, literal, tr.Define("/\\(literal\\)"))
+
+		assert.True(tr.Has(`/emoji/\(o_o\)`))
+		assert.False(tr.Has(`/emoji/\(x_x\)`))
+		path, err := emoji.BuildPath(nil)
+		assert.Nil(err)
+		assert.Equal("/emoji/(o_o)", path)
+
+		assert.Panics(func() {
+			tr.Define("/(other)")
+		})
+	})
+
+	t.Run("trailing slash on catch-all routes", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		files := tr.Define("/files/:path*")
+
+		res := tr.Match("/files/a/b/")
+		EqualPtr(t, files, res.Node)
+		assert.Equal("a/b/", res.Params["path"])
+		assert.Equal("", res.TSR)
+		assert.Equal("", res.FPR)
+
+		res = tr.Match("/files/")
+		EqualPtr(t, files, res.Node)
+		assert.Equal("", res.Params["path"])
+		assert.Equal("", res.TSR)
+
+		res = tr.Match("/files")
+		assert.Nil(res.Node)
+		assert.Equal("", res.TSR)
+
+		res = tr.Match("/files//a/b/")
+		assert.Nil(res.Node)
+		assert.Equal("", res.TSR)
+		assert.Equal("/files/a/b/", res.FPR)
+
+		root := tr.Define("/files")
+		EqualPtr(t, root, tr.Match("/files").Node)
+		EqualPtr(t, files, tr.Match("/files/").Node)
+		assert.Equal("", tr.Match("/files/").TSR)
+
+		tr = New()
+		docs := tr.Define("/docs")
+		tr.Define("/docs/:path*([a-z/]+)")
+		res = tr.Match("/docs/")
+		assert.Nil(res.Node)
+		assert.Equal("/docs", res.TSR)
+		EqualPtr(t, docs, tr.Match("/docs").Node)
+		assert.Equal("a/b/", tr.Match("/docs/a/b/").Params["path"])
+		assert.Equal("", tr.Match("/docs/A/b/").TSR)
+	})
+
+	t.Run("MatchAll method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		readme := tr.Define("/files/readme")
+		id := tr.Define("/files/:id+me")
+		name := tr.Define("/files/:name")
+		path := tr.Define("/files/:path*")
+		nested := tr.Define("/files/:name/raw")
+
+		results := tr.MatchAll("/files/readme")
+		assert.Equal(4, len(results))
+		EqualPtr(t, readme, results[0].Node)
+		EqualPtr(t, id, results[1].Node)
+		assert.Equal("read", results[1].Params["id"])
+		EqualPtr(t, name, results[2].Node)
+		assert.Equal("readme", results[2].Params["name"])
+		EqualPtr(t, path, results[3].Node)
+		assert.Equal("readme", results[3].Params["path"])
+		EqualPtr(t, tr.Match("/files/readme").Node, results[0].Node)
+
+		results = tr.MatchAll("/files/123")
+		assert.Equal(2, len(results))
+		EqualPtr(t, name, results[0].Node)
+		EqualPtr(t, path, results[1].Node)
+
+		results = tr.MatchAll("/files/a/raw")
+		assert.Equal(2, len(results))
+		EqualPtr(t, nested, results[0].Node)
+		assert.Equal("a", results[0].Params["name"])
+		assert.Equal("/files/:name/raw", results[0].Pattern)
+		assert.Equal(3, results[0].MatchedDepth)
+		EqualPtr(t, path, results[1].Node)
+		assert.Equal("a/raw", results[1].Params["path"])
+
+		// Match doesn't backtrack, but MatchAll finds the full match
+		assert.Nil(tr.Match("/files/a/b").Node)
+		results = tr.MatchAll("/files/a/b")
+		assert.Equal(1, len(results))
+		EqualPtr(t, path, results[0].Node)
+
+		results = tr.MatchAll("/files/README")
+		assert.Equal(4, len(results))
+		EqualPtr(t, readme, results[0].Node)
+		assert.Equal("READ", results[1].Params["id"])
+
+		assert.Equal(0, len(tr.MatchAll("/other")))
+		assert.Equal(0, len(tr.MatchAll("/files")))
+
+		tr = New()
+		node := tr.Define("/a/:x/b/:y")
+		results = tr.MatchAll("/a/1/b/2")
+		assert.Equal(1, len(results))
+		EqualPtr(t, node, results[0].Node)
+		assert.Equal(map[string]string{"x": "1", "y": "2"}, results[0].Params)
+
+		assert.Panics(func() {
+			tr.MatchAll("a")
+		})
+	})
+
+	t.Run("Matched.OrderedParams method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{AnonymousParams: true})
+		tr.Define("/a/:x/b/:y")
+		tr.Define("/c/:z/:/:w+.json/:rest*")
+
+		res := tr.Match("/a/1/b/2")
+		assert.Equal([]Param{{"x", "1"}, {"y", "2"}}, res.OrderedParams())
+		for i := 0; i < 10; i++ {
+			assert.Equal([]Param{{"x", "1"}, {"y", "2"}}, tr.Match("/a/1/b/2").OrderedParams())
+		}
+
+		res = tr.Match("/c/3/anon/4.json/d/e")
+		assert.Equal([]Param{{"z", "3"}, {"w", "4"}, {"rest", "d/e"}}, res.OrderedParams())
+		assert.Equal([]string{"anon"}, res.Positional)
+
+		params := res.OrderedParams()
+		params[0].Value = "x"
+		assert.Equal("3", res.OrderedParams()[0].Value)
+
+		assert.Nil(tr.Match("/none").OrderedParams())
+		assert.Equal([]Param{{"x", "1"}, {"y", "2"}}, tr.MatchAll("/a/1/b/2")[0].OrderedParams())
+
+		path := []byte("/a/1/b/2")
+		res = tr.MatchBytes(path)
+		copy(path, "/a/3/b/4")
+		assert.Equal([]Param{{"x", "1"}, {"y", "2"}}, res.OrderedParams())
+	})
+
+	t.Run("Options.TenantPrefix", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{TenantPrefix: "/t/:tenant", TrailingSlashRedirect: true, FixedPathRedirect: true})
+		user := tr.Define("/users/:id")
+		root := tr.Define("/")
+
+		res := tr.Match("/t/acme/users/1")
+		EqualPtr(t, user, res.Node)
+		assert.Equal(map[string]string{"tenant": "acme", "id": "1"}, res.Params)
+		assert.Equal([]Param{{"tenant", "acme"}, {"id", "1"}}, res.OrderedParams())
+		assert.Equal("/users/:id", res.Pattern)
+		assert.Equal(4, res.MatchedDepth)
+
+		res = tr.Match("/t/acme/")
+		EqualPtr(t, root, res.Node)
+		assert.Equal("acme", res.Params["tenant"])
+		res = tr.Match("/t/acme")
+		EqualPtr(t, root, res.Node)
+
+		res = tr.Match("/t/acme/users/1/")
+		assert.Nil(res.Node)
+		assert.Equal("/t/acme/users/1", res.TSR)
+		res = tr.Match("/t/acme//users/1")
+		assert.Nil(res.Node)
+		assert.Equal("/t/acme/users/1", res.FPR)
+
+		assert.Nil(tr.Match("/users/1").Node)
+		assert.Nil(tr.Match("/x/acme/users/1").Node)
+		assert.Nil(tr.Match("/t").Node)
+		assert.Nil(tr.Match("/t/acme/other").Node)
+
+		tr = New(Options{TenantPrefix: "/:region(^[a-z]{2}$)/:tenant"})
+		tr.Define("/users")
+		assert.Equal(map[string]string{"region": "eu", "tenant": "acme"}, tr.Match("/eu/acme/users").Params)
+		assert.Nil(tr.Match("/europe/acme/users").Node)
+		assert.Nil(tr.Match("/eu/acme").Node)
+
+		tr = New(Options{TenantPrefix: "/static"})
+		tr.Define("/a")
+		assert.NotNil(tr.Match("/static/a").Node)
+		assert.Nil(tr.Match("/static/a").Params)
+	})
+
+	t.Run("Trie.MatchMethod", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/a")
+		node.Handle("GET", "get")
+		node.Handle("PUT", "put")
+
+		res := tr.MatchMethod("POST", "/a")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("GET, PUT", res.Allow)
+		assert.Nil(res.Handler("POST"))
+
+		res = tr.MatchMethod("GET", "/a")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("", res.Allow)
+		res = tr.MatchMethod("HEAD", "/a")
+		assert.Equal("", res.Allow)
+
+		res = tr.MatchMethod("GET", "/b")
+		assert.Nil(res.Node)
+		assert.Equal("", res.Allow)
+
+		tr.SetMethodNotAllowed("405")
+		h, res := tr.Lookup("DELETE", "/a")
+		assert.Equal("405", h)
+		EqualPtr(t, node, res.Node)
+		assert.Equal("GET, PUT", res.Allow)
+		assert.Equal("", tr.Match("/a").Allow)
+	})
+
+	t.Run("Options.TrackRegexEvals", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{TrackRegexEvals: true})
+		tr.Define("/:org(^[a-z]+$)/:repo(^[a-z]+$)")
+		tr.Define("/:org(^[a-z]+$)/:id(^[0-9]+$)")
+		tr.Define("/:org(^[a-z]+$)/static")
+
+		res := tr.Match("/acme/123")
+		assert.Equal("123", res.Params["id"])
+		assert.Equal(3, res.RegexEvals)
+		res = tr.Match("/acme/web")
+		assert.Equal("web", res.Params["repo"])
+		assert.Equal(2, res.RegexEvals)
+		res = tr.Match("/acme/static")
+		assert.NotNil(res.Node)
+		assert.Equal(1, res.RegexEvals)
+		res = tr.Match("/123/web")
+		assert.Nil(res.Node)
+		assert.Equal(1, res.RegexEvals)
+
+		tr = New()
+		tr.Define("/:org(^[a-z]+$)/:repo(^[a-z]+$)")
+		assert.Equal(0, tr.Match("/acme/web").RegexEvals)
+	})
+
+	t.Run("percent-encoded paths for redirects", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal("/a/%2F/b", fixPath("/a/%2F/b"))
+		assert.Equal("/a/%2F%2F/b", fixPath("/a/%2F%2F/b"))
+		assert.Equal("/a/%2F%2F/b", fixPath("/a//%2F%2F//b"))
+		assert.Equal("/a/%2f/", fixPath("//a/%2f//"))
+
+		tr := New()
+		node := tr.Define("/a/:name/b")
+		res := tr.Match("/a/%2F/b")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("%2F", res.Params["name"])
+		assert.Equal("", res.FPR)
+
+		res = tr.Match("/a/%2F%2F/b")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("%2F%2F", res.Params["name"])
+
+		res = tr.Match("/a//%2F%2F/b")
+		assert.Nil(res.Node)
+		assert.Equal("/a/%2F%2F/b", res.FPR)
+
+		res = tr.Match("/a/%2F/b/")
+		assert.Nil(res.Node)
+		assert.Equal("/a/%2F/b", res.TSR)
+		res = tr.Match("/a/%2F//b//")
+		assert.Nil(res.Node)
+		assert.Equal("/a/%2F/b", res.FPR)
+		assert.Equal("", res.TSR)
+
+		tr.Define("/files/:path*")
+		res = tr.Match("/files/x%2F%2Fy")
+		assert.Equal("x%2F%2Fy", res.Params["path"])
+		assert.Equal("", res.FPR)
+	})
+
+	t.Run("extension parameters", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/users/:id.:format")
+		res := tr.Match("/users/42.json")
+		EqualPtr(t, node, res.Node)
+		assert.Equal(map[string]string{"id": "42", "format": "json"}, res.Params)
+		assert.Equal([]Param{{"id", "42"}, {"format", "json"}}, res.OrderedParams())
+		assert.Equal("/users/:id.:format", res.Pattern)
+
+		assert.Equal(map[string]string{"id": "v1.2", "format": "xml"}, tr.Match("/users/v1.2.xml").Params)
+		assert.Nil(tr.Match("/users/42").Node)
+		assert.Nil(tr.Match("/users/42.").Node)
+		assert.Nil(tr.Match("/users/.json").Node)
+
+		// a value with no extension falls through to a sibling
+		plain := tr.Define("/users/:id")
+		EqualPtr(t, node, tr.Match("/users/42.json").Node)
+		res = tr.Match("/users/42")
+		EqualPtr(t, plain, res.Node)
+		assert.Equal(map[string]string{"id": "42"}, res.Params)
+		assert.Nil(tr.Unreachable())
+
+		num := tr.Define("/files/:id(^[0-9]+$).:ext")
+		tr.Define("/files/:name")
+		EqualPtr(t, num, tr.Match("/files/1.txt").Node)
+		assert.Equal("txt", tr.Match("/files/1.txt").Params["ext"])
+		assert.Equal("a.txt", tr.Match("/files/a.txt").Params["name"])
+
+		path, err := node.BuildPath(map[string]string{"id": "42", "format": "json"})
+		assert.Nil(err)
+		assert.Equal("/users/42.json", path)
+		_, err = node.BuildPath(map[string]string{"id": "42"})
+		assert.True(errors.Is(err, ErrMissingParam))
+		_, err = node.BuildPath(map[string]string{"id": "42", "format": "a.b"})
+		assert.True(errors.Is(err, ErrInvalidParam))
+
+		EqualPtr(t, node, tr.Define("/users/:id.:format"))
+		assert.Panics(func() { tr.Define("/users/:name.:format") })
+		assert.Panics(func() { tr.Define("/x/:.:format") })
+		assert.Panics(func() { tr.Define("/x/:id.:") })
+		assert.Panics(func() { tr.Define("/x/:id.:f(x)") })
+	})
+
+	t.Run("catch-all param with regexp for the whole remainder", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define(`/releases/:tag*(v[0-9]+\.[0-9]+\.[0-9]+(/[a-z]+)?)`)
+		res := tr.Match("/releases/v1.2.3")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("v1.2.3", res.Params["tag"])
+		res = tr.Match("/releases/v1.2.3/notes")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("v1.2.3/notes", res.Params["tag"])
+
+		assert.Nil(tr.Match("/releases/v1.2").Node)
+		assert.Nil(tr.Match("/releases/v1.2.3/x/y").Node)
+		assert.Nil(tr.Match("/releases/xv1.2.3").Node)
+		assert.Nil(tr.Match("/releases/v1.2.3/").Node)
+
+		// the regexp of a per-segment param never sees "/"
+		tr.Define(`/tags/:tag(^v[0-9]+(/[a-z]+)?$)`)
+		assert.NotNil(tr.Match("/tags/v1").Node)
+		assert.Nil(tr.Match("/tags/v1/notes").Node)
+
+		assert.Panics(func() { tr.Define(`/x/:tag(v[0-9]+)*`) })
+	})
+
+	t.Run("Options.NormalizePercentEncoding", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal("/a/%2F/b", normalizePercent("/a/%2f/b"))
+		assert.Equal("/a/%2F/%C3%A9", normalizePercent("/a/%2F/%c3%a9"))
+		assert.Equal("/a/%zz/%2/%", normalizePercent("/a/%zz/%2/%"))
+		assert.Equal("/100%/%AB", normalizePercent("/100%/%ab"))
+		assert.Equal("/%%2F", normalizePercent("/%%2f"))
+
+		tr := New(Options{NormalizePercentEncoding: true, TrailingSlashRedirect: true})
+		node := tr.Define("/a/:name/b")
+		res := tr.Match("/a/%2F/b")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("%2F", res.Params["name"])
+		assert.Equal("", res.FPR)
+
+		res = tr.Match("/a/%2f/b")
+		assert.Nil(res.Node)
+		assert.Equal("/a/%2F/b", res.FPR)
+		res = tr.Match("/a/%2f/b/")
+		assert.Nil(res.Node)
+		assert.Equal("/a/%2F/b", res.FPR)
+		assert.Equal("", res.TSR)
+		res = tr.Match("/a/%2F/b/")
+		assert.Equal("/a/%2F/b", res.TSR)
+
+		res = tr.Match("/a/50%/b")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("50%", res.Params["name"])
+
+		// combined with FixedPathRedirect
+		tr = New(Options{NormalizePercentEncoding: true, FixedPathRedirect: true})
+		tr.Define("/a/:name/b")
+		assert.Equal("/a/%2F/b", tr.Match("/a//%2f/b").FPR)
+
+		tr = New(Options{})
+		tr.Define("/a/:name/b")
+		assert.Equal("%2f", tr.Match("/a/%2f/b").Params["name"])
+	})
+
+	t.Run("Trie.MatchLongest", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{AnonymousParams: true})
+		ab := tr.Define("/a/b")
+		user := tr.Define("/users/:id")
+		tr.Define("/users/:id/posts/:post/comments")
+		file := tr.Define("/files/:path*")
+		tr.Define("/x/:")
+
+		res := tr.MatchLongest("/a/b/c")
+		EqualPtr(t, ab, res.Node)
+		assert.Equal("/a/b", res.Pattern)
+		assert.Equal("/c", res.Tail)
+		assert.Equal(2, res.MatchedDepth)
+		assert.Nil(res.Params)
+
+		res = tr.MatchLongest("/a/b")
+		EqualPtr(t, ab, res.Node)
+		assert.Equal("", res.Tail)
+		res = tr.MatchLongest("/a/b/")
+		EqualPtr(t, ab, res.Node)
+		assert.Equal("/", res.Tail)
+
+		res = tr.MatchLongest("/users/1/posts/2/x")
+		EqualPtr(t, user, res.Node)
+		assert.Equal("/posts/2/x", res.Tail)
+		assert.Equal(map[string]string{"id": "1"}, res.Params)
+		assert.Equal([]Param{{"id", "1"}}, res.OrderedParams())
+
+		res = tr.MatchLongest("/files/a/b")
+		EqualPtr(t, file, res.Node)
+		assert.Equal("a/b", res.Params["path"])
+		assert.Equal("", res.Tail)
+
+		res = tr.MatchLongest("/x/1/2")
+		assert.Equal([]string{"1"}, res.Positional)
+		assert.Equal("/2", res.Tail)
+
+		res = tr.MatchLongest("/a/c")
+		assert.Nil(res.Node)
+		assert.Equal("", res.Tail)
+		assert.Equal(1, res.MatchedDepth)
+
+		tr.Define("/hook").Exact()
+		assert.NotNil(tr.MatchLongest("/hook").Node)
+		assert.Nil(tr.MatchLongest("/hook/x").Node)
+		assert.Equal("", tr.Match("/a/b/c").Tail)
+	})
+
+	t.Run("optional pattern", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{FixedPathRedirect: false, TrailingSlashRedirect: true, StrictEmptyParams: true})
+		node := tr.Define("/a/:maybe?/b")
+		res := tr.Match("/a//b")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("", res.Params["maybe"])
+		_, ok := res.Params["maybe"]
+		assert.True(ok)
+		assert.Equal("x", tr.Match("/a/x/b").Params["maybe"])
+		assert.Equal("/a/:maybe?/b", node.GetPattern())
+		EqualPtr(t, node, tr.Define("/a/:maybe?/b"))
+
+		// a param doesn't match an empty segment unless it is optional
+		node = tr.Define("/c/:must/d")
+		assert.Nil(tr.Match("/c//d").Node)
+		EqualPtr(t, node, tr.Match("/c/x/d").Node)
+		tr.Define("/c")
+		res = tr.Match("/c/")
+		assert.Nil(res.Node)
+		assert.Equal("/c", res.TSR)
+
+		// the regexp is not checked for an empty segment
+		node = tr.Define("/e/:id(^[0-9]+$)?")
+		EqualPtr(t, node, tr.Match("/e/").Node)
+		assert.Equal("12", tr.Match("/e/12").Params["id"])
+		assert.Nil(tr.Match("/e/ab").Node)
+
+		path, err := tr.Match("/a//b").Node.BuildPath(map[string]string{"maybe": ""})
+		assert.Nil(err)
+		assert.Equal("/a//b", path)
+		_, err = tr.Match("/c/x/d").Node.BuildPath(map[string]string{"must": ""})
+		assert.True(errors.Is(err, ErrInvalidParam))
+
+		assert.Panics(func() {
+			tr.Define("/a/:maybe/c")
+		})
+		assert.Panics(func() {
+			tr.Define("/a/:?")
+		})
+
+		// a param matches an empty segment by default
+		tr = New(Options{TrailingSlashRedirect: true})
+		node = tr.Define("/c/:must/d")
+		res = tr.Match("/c//d")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("", res.Params["must"])
+		path, err = node.BuildPath(map[string]string{"must": ""})
+		assert.Nil(err)
+		assert.Equal("/c//d", path)
+
+		// FixedPathRedirect collapses "//" before matching, "/a//b" is matched as "/a/b"
+		tr = New(Options{FixedPathRedirect: true})
+		tr.Define("/a/:maybe?/b")
+		assert.Nil(tr.Match("/a//b").Node)
+		node = tr.Define("/a/:maybe?")
+		res = tr.Match("/a/")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("", res.Params["maybe"])
+	})
+
+	t.Run("non-empty wildcard pattern", func(t *testing.T) {
+		assert := assert.New(t)
+
+		for _, opts := range []Options{{}, {WildcardLeadingSlash: true}} {
+			tr := New(opts)
+			node := tr.Define("/proxy/:target+")
+			assert.Nil(tr.Match("/proxy").Node)
+			assert.Nil(tr.Match("/proxy/").Node)
+
+			res := tr.Match("/proxy/a")
+			EqualPtr(t, node, res.Node)
+			if opts.WildcardLeadingSlash {
+				assert.Equal("/a", res.Params["target"])
+			} else {
+				assert.Equal("a", res.Params["target"])
+			}
+			EqualPtr(t, node, tr.Match("/proxy/example.com/a").Node)
+			EqualPtr(t, node, tr.Define("/proxy/:target+"))
+			assert.True(tr.Has("/proxy/:target+"))
+			assert.False(tr.Has("/proxy/:target*"))
+
+			assert.Panics(func() {
+				tr.Define("/proxy/:target*")
+			})
+		}
+
+		// the empty remainder still matches ":target*"
+		tr := New()
+		tr.Define("/proxy/:target*")
+		assert.Equal("", tr.Match("/proxy/").Params["target"])
+		assert.Panics(func() {
+			tr.Define("/proxy/:target+")
+		})
+
+		tr = New()
+		node := tr.Define("/proxy/:target+")
+		path, err := node.BuildPath(map[string]string{"target": "a/b"})
+		assert.Nil(err)
+		assert.Equal("/proxy/a/b", path)
+		_, err = node.BuildPath(map[string]string{"target": ""})
+		assert.True(errors.Is(err, ErrInvalidParam))
+	})
+
+	t.Run("OnMiss", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/api/users/:id/posts")
+		tr.Define("/api/teams")
+		var misses []string
+		tr.OnMiss(func(path string, depth int) {
+			misses = append(misses, path+" "+strconv.Itoa(depth))
+		})
+
+		assert.Nil(tr.Match("/api/users/42/comments").Node)
+		assert.Equal([]string{"/api/users/42/comments 3"}, misses)
+
+		// not called for a match or a redirect
+		misses = nil
+		tr.Match("/api/users/42/posts")
+		tr.Match("/api/teams/")
+		tr.Match("/api//teams")
+		assert.Nil(misses)
+
+		tr.Match("/api//none")
+		tr.Match("/none")
+		tr.Match("/api/users/42")
+		assert.Equal([]string{"/api//none 1", "/none 0", "/api/users/42 3"}, misses)
+
+		tr.Freeze()
+		assert.Panics(func() {
+			tr.OnMiss(func(string, int) {})
+		})
+	})
+
+	t.Run("MatchPartial", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/t/:tenant/users/:id")
+
+		res := tr.MatchPartial("/t/acme/unknown")
+		assert.Nil(res.Node)
+		assert.Equal("acme", res.Params["tenant"])
+		assert.Equal("/unknown", res.Tail)
+		assert.Equal(2, res.MatchedDepth)
+
+		res = tr.MatchPartial("/t/acme/users")
+		assert.Nil(res.Node)
+		assert.Equal(map[string]string{"tenant": "acme"}, res.Params)
+		assert.Equal("", res.Tail)
+
+		res = tr.MatchPartial("/t/acme/users/7/x")
+		assert.Equal("7", res.Params["id"])
+		assert.Equal("/x", res.Tail)
+
+		res = tr.MatchPartial("/t//acme/oops")
+		assert.Equal("acme", res.Params["tenant"])
+		assert.Equal("/oops", res.Tail)
+
+		res = tr.MatchPartial("/none/a")
+		assert.Nil(res.Params)
+		assert.Equal("/none/a", res.Tail)
+
+		// a full match is the same as Match
+		res = tr.MatchPartial("/t/acme/users/7")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("", res.Tail)
+		assert.Equal(tr.Match("/t/acme/users/7").Params, res.Params)
+	})
+
+	t.Run("Options.RegexFirst", func(t *testing.T) {
+		assert := assert.New(t)
+
+		define := func(tr *Trie) (static, regex, param *Node) {
+			static = tr.Define("/users/me")
+			regex = tr.Define("/users/:id(^[a-z]+$)")
+			param = tr.Define("/users/:other")
+			tr.Define("/users/me/settings")
+			return
+		}
+
+		// static first by default
+		tr := New(Options{})
+		static, regex, param := define(tr)
+		EqualPtr(t, static, tr.Match("/users/me").Node)
+		EqualPtr(t, regex, tr.Match("/users/you").Node)
+		EqualPtr(t, param, tr.Match("/users/42").Node)
+		assert.NotNil(tr.Match("/users/me/settings").Node)
+
+		tr = New(Options{RegexFirst: true})
+		static, regex, param = define(tr)
+		res := tr.Match("/users/me")
+		EqualPtr(t, regex, res.Node)
+		assert.Equal("me", res.Params["id"])
+		EqualPtr(t, regex, tr.Match("/users/you").Node)
+		EqualPtr(t, param, tr.Match("/users/42").Node)
+		// the static subtree is not reached for a segment that the regexp matches
+		assert.Nil(tr.Match("/users/me/settings").Node)
+		// a static child is still matched when the regexp doesn't match
+		EqualPtr(t, tr.Define("/users/v2"), tr.Match("/users/v2").Node)
+		NotEqualPtr(t, static, tr.Match("/users/me").Node)
+
+		res, steps := tr.MatchTrace("/users/42")
+		EqualPtr(t, param, res.Node)
+		assert.Equal([]TraceStep{
+			{"users", "static", "/users", true},
+			{"42", "regex", "/users/:id(^[a-z]+$)", false},
+			{"42", "static", "", false},
+			{"42", "param", "/users/:other", true},
+		}, steps)
+
+		data, err := tr.Snapshot()
+		assert.Nil(err)
+		restored, err := LoadSnapshot(data, nil)
+		assert.Nil(err)
+		assert.True(restored.Options().RegexFirst)
+	})
+
+	t.Run(`regexp param with "*(" in the regexp`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/x/:id(^a*(b|c)$)")
+		assert.False(node.wildcard)
+
+		res := tr.Match("/x/aab")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("aab", res.Params["id"])
+		assert.Nil(tr.Match("/x/aad").Node)
+		assert.Nil(tr.Match("/x/ab/c").Node)
+	})
+
+	t.Run(`suffix param with a suffix ending in "+"`, func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/x/:id+x+")
+		assert.False(node.wildcard)
+		assert.Equal("x+", node.suffix)
+
+		res := tr.Match("/x/123x+")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("123", res.Params["id"])
+		assert.Nil(tr.Match("/x/123x").Node)
+
+		node = tr.Define("/y/:rest+")
+		assert.True(node.wildcard)
+		assert.True(node.nonEmpty)
+	})
+}
+
+func TestGearTrieNode(t *testing.T) {
+	t.Run("Node Handle", func(t *testing.T) {
+		assert := assert.New(t)
+
+		handler := func() {}
+		tr := New()
+		tr.Define("/").Handle("GET", handler)
+		tr.Define("/").Handle("PUT", handler)
+		tr.Define("/api").Handle("GET", handler)
+
+		assert.Panics(func() {
+			tr.Define("/").Handle("GET", handler)
+		})
+		assert.Panics(func() {
+			tr.Define("/").Handle("PUT", handler)
+		})
+		assert.Panics(func() {
+			tr.Define("/api").Handle("GET", handler)
+		})
+
+		EqualPtr(t, handler, tr.Match("/").Node.GetHandler("GET").(func()))
+		EqualPtr(t, handler, tr.Match("/").Node.GetHandler("PUT").(func()))
+		assert.Equal("GET, PUT", tr.Match("/").Node.GetAllow())
+
+		EqualPtr(t, handler, tr.Match("/api").Node.GetHandler("GET").(func()))
+		assert.Equal("GET", tr.Match("/api").Node.GetAllow())
+	})
+
+	t.Run("IgnoreMethodCase option", func(t *testing.T) {
+		assert := assert.New(t)
+
+		handler1 := func() {}
+		handler2 := func() {}
+		tr := New(Options{IgnoreMethodCase: true})
+		node := tr.Define("/api")
+		node.Handle("get", handler1)
+		node.Handle("Put", handler2)
+		assert.Panics(func() {
+			node.Handle("GET", handler1)
+		})
+
+		EqualPtr(t, handler1, node.GetHandler("GET").(func()))
+		EqualPtr(t, handler1, node.GetHandler("get").(func()))
+		EqualPtr(t, handler2, node.GetHandler("pUT").(func()))
+		assert.Equal("GET, PUT", node.GetAllow())
+
+		tr = New(Options{IgnoreMethodCase: false})
+		node = tr.Define("/api")
+		node.Handle("get", handler1)
+		assert.Nil(node.GetHandler("GET"))
+		EqualPtr(t, handler1, node.GetHandler("get").(func()))
+		assert.Equal("get", node.GetAllow())
+	})
+
+	t.Run("Trie Lookup with fallbacks", func(t *testing.T) {
+		assert := assert.New(t)
+
+		handler := func() {}
+		notFound := func() {}
+		notAllowed := func() {}
+		tr := New()
+		tr.Define("/api").Handle("GET", handler)
+
+		h, res := tr.Lookup("PUT", "/api")
+		assert.Nil(h)
+		EqualPtr(t, tr.Define("/api"), res.Node)
+		h, _ = tr.Lookup("GET", "/none")
+		assert.Nil(h)
+
+		tr.SetNotFound(notFound)
+		tr.SetMethodNotAllowed(notAllowed)
+		EqualPtr(t, notFound, tr.NotFound().(func()))
+		EqualPtr(t, notAllowed, tr.MethodNotAllowed().(func()))
+
+		h, res = tr.Lookup("GET", "/api")
+		EqualPtr(t, handler, h.(func()))
+		EqualPtr(t, tr.Define("/api"), res.Node)
+
+		h, _ = tr.Lookup("PUT", "/api")
+		EqualPtr(t, notAllowed, h.(func()))
+
+		h, res = tr.Lookup("GET", "/none")
+		EqualPtr(t, notFound, h.(func()))
+		assert.Nil(res.Node)
+
+		h, res = tr.Lookup("GET", "/api/")
+		assert.Nil(h)
+		assert.Equal("/api", res.TSR)
+	})
+
+	t.Run("Trie Route", func(t *testing.T) {
+		assert := assert.New(t)
+
+		handler1 := func() {}
+		handler2 := func() {}
+		tr := New()
+		node := tr.Route("GET", "/users/:id", handler1)
+		EqualPtr(t, node, tr.Route("PUT", "/users/:id", handler2))
+		EqualPtr(t, node, tr.Define("/users/:id"))
+		assert.Panics(func() {
+			tr.Route("GET", "/users/:id", handler2)
+		})
+
+		res := tr.Match("/users/123")
+		EqualPtr(t, node, res.Node)
+		EqualPtr(t, handler1, res.Node.GetHandler("GET").(func()))
+		EqualPtr(t, handler2, res.Node.GetHandler("PUT").(func()))
+		assert.Equal("GET, PUT", res.Node.GetAllow())
+	})
+
+	t.Run("Matched Handler", func(t *testing.T) {
+		assert := assert.New(t)
+
+		get := func() {}
+		head := func() {}
+		fallback := func() {}
+		tr := New(Options{IgnoreMethodCase: true})
+		tr.Route("GET", "/a", get)
+		tr.Route("GET", "/b", get)
+		tr.Route("HEAD", "/b", head)
+		tr.Route("*", "/b", fallback)
+		tr.Route("*", "/c", fallback)
+
+		res := tr.Match("/a")
+		EqualPtr(t, get, res.Handler("GET").(func()))
+		EqualPtr(t, get, res.Handler("get").(func()))
+		EqualPtr(t, get, res.Handler("HEAD").(func()))
+		EqualPtr(t, get, res.Handler("head").(func()))
+		assert.Nil(res.Handler("POST"))
+
+		res = tr.Match("/b")
+		EqualPtr(t, get, res.Handler("GET").(func()))
+		EqualPtr(t, head, res.Handler("HEAD").(func()))
+		EqualPtr(t, fallback, res.Handler("POST").(func()))
+
+		res = tr.Match("/c")
+		EqualPtr(t, fallback, res.Handler("GET").(func()))
+		EqualPtr(t, fallback, res.Handler("HEAD").(func()))
+
+		assert.Nil(tr.Match("/d").Handler("GET"))
+
+		h, _ := tr.Lookup("HEAD", "/a")
+		EqualPtr(t, get, h.(func()))
+	})
+
+	t.Run("Node EachHandler", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/api")
+		node.EachHandler(func(method string, handler interface{}) {
+			t.Fatal("should not be called")
+		})
+
+		node.Handle("PUT", "put")
+		node.Handle("GET", "get")
+		node.Handle("DELETE", "delete")
+
+		var methods []string
+		node.EachHandler(func(method string, handler interface{}) {
+			methods = append(methods, method)
+			assert.Equal(strings.ToLower(method), handler)
+		})
+		assert.Equal([]string{"PUT", "GET", "DELETE"}, methods)
+	})
+
+	t.Run("Node.Priority method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		id := tr.Define("/files/:id(^[0-9]+$)")
+		name := tr.Define("/files/:name(^[a-z0-9]+$)")
+		EqualPtr(t, id, tr.Match("/files/123").Node)
+		EqualPtr(t, name, tr.Match("/files/abc").Node)
+
+		name.Priority(1)
+		EqualPtr(t, name, tr.Match("/files/123").Node)
+		assert.Equal("123", tr.Match("/files/123").Params["name"])
+
+		id.Priority(2)
+		EqualPtr(t, id, tr.Match("/files/123").Node)
+
+		tr = New()
+		bare := tr.Define("/users/:user")
+		regex := tr.Define("/users/:uid(^[0-9]+$)")
+		EqualPtr(t, regex, tr.Match("/users/123").Node)
+		bare.Priority(1)
+		EqualPtr(t, bare, tr.Match("/users/123").Node)
+
+		tr = New()
+		tr.Define("/static/:file")
+		all := tr.Define("/static/:path*")
+		all.Priority(1)
+		res := tr.MatchSegments([]string{"static", "a", "b"})
+		EqualPtr(t, all, res.Node)
+		assert.Equal("a/b", res.Params["path"])
+	})
+
+	t.Run("Node.SamePattern method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr1 := New()
+		tr2 := New()
+		EqualPtr(t, tr1.Define("/a/b"), tr1.Define("/a/b"))
+		NotEqualPtr(t, tr1.Define("/a/b"), tr2.Define("/a/b"))
+
+		assert.True(tr1.Define("/a/b").SamePattern(tr2.Define("/a/b")))
+		assert.True(tr1.Define("/a/:id(^\\d+$)").SamePattern(tr2.Define("/a/:id(^\\d+$)")))
+		assert.True(tr1.Define("/a/:id").SamePattern(tr1.Define("/a/:id")))
+		assert.True(tr1.Define("/").SamePattern(tr2.Define("/")))
+
+		assert.False(tr1.Define("/a/b").SamePattern(tr2.Define("/a/b/")))
+		assert.False(tr1.Define("/a/:id").SamePattern(tr2.Define("/a/:name")))
+		assert.False(tr1.Define("/a/b").SamePattern(tr2.Define("/a")))
+		assert.False(tr1.Define("/a/b").SamePattern(nil))
+	})
+
+	t.Run("Node.BuildPath and Node.SetDefault methods", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/users/:user/repos/:repo(^[a-z]+$)")
+		path, err := node.BuildPath(map[string]string{"user": "tom", "repo": "trie"})
+		assert.Nil(err)
+		assert.Equal("/users/tom/repos/trie", path)
+		EqualPtr(t, node, tr.Match(path).Node)
+
+		_, err = node.BuildPath(map[string]string{"user": "tom"})
+		assert.ErrorIs(err, ErrMissingParam)
+		_, err = node.BuildPath(map[string]string{"user": "tom", "repo": "123"})
+		assert.ErrorIs(err, ErrInvalidParam)
+
+		node.SetDefault("repo", "main")
+		path, err = node.BuildPath(map[string]string{"user": "tom"})
+		assert.Nil(err)
+		assert.Equal("/users/tom/repos/main", path)
+		path, err = node.BuildPath(map[string]string{"user": "tom", "repo": "trie"})
+		assert.Nil(err)
+		assert.Equal("/users/tom/repos/trie", path)
+
+		posts := tr.Define("/posts/:page")
+		tr.Define("/posts").SetDefault("page", "1")
+		path, err = posts.BuildPath(nil)
+		assert.Nil(err)
+		assert.Equal("/posts/1", path)
+		posts.SetDefault("page", "2")
+		path, _ = posts.BuildPath(nil)
+		assert.Equal("/posts/2", path)
+
+		path, err = tr.Define("/").BuildPath(nil)
+		assert.Nil(err)
+		assert.Equal("/", path)
+
+		path, err = tr.Define("/a/::b/:file+.json/").BuildPath(map[string]string{"file": "x"})
+		assert.Nil(err)
+		assert.Equal("/a/:b/x.json/", path)
+		assert.Equal("/a/::b/:file+.json/", tr.Match(path).Pattern)
+
+		path, err = tr.Define("/files/:path*").BuildPath(map[string]string{"path": "a/b/c"})
+		assert.Nil(err)
+		assert.Equal("/files/a/b/c", path)
+
+		path, err = tr.Define("/[::1]/:id").BuildPath(map[string]string{"id": "1"})
+		assert.Nil(err)
+		assert.Equal("/[::1]/1", path)
+
+		// a built path matches the node again
+		item := tr.Define("/items/:id/detail")
+		_, err = item.BuildPath(map[string]string{"id": "a/b"})
+		assert.ErrorIs(err, ErrInvalidParam)
+		path, err = item.BuildPath(map[string]string{"id": "a"})
+		assert.Nil(err)
+		EqualPtr(t, item, tr.Match(path).Node)
+	})
+
+	t.Run("Node.Delegate method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		status := tr.Define("/db/status")
+		db := status.parent
+		table := &Node{}
+		var remains []string
+		db.Delegate(func(remaining string) *Matched {
+			remains = append(remains, remaining)
+			if strings.HasPrefix(remaining, "/tables/") {
+				return &Matched{Node: table, Params: map[string]string{"table": remaining[8:]}}
+			}
+			return nil
+		})
+
+		res := tr.Match("/db/tables/users")
+		EqualPtr(t, table, res.Node)
+		assert.Equal("users", res.Params["table"])
+		assert.Equal([]string{"/tables/users"}, remains)
+
+		EqualPtr(t, status, tr.Match("/db/status").Node)
+		assert.Nil(tr.Match("/db/status/tables/x").Node)
+		assert.Equal("/status/tables/x", remains[len(remains)-1])
+
+		res = tr.Match("/db/other")
+		assert.Nil(res.Node)
+		assert.Equal("/other", remains[len(remains)-1])
+
+		remains = nil
+		res = tr.Match("/db/status/")
+		assert.Nil(res.Node)
+		assert.Equal("/db/status", res.TSR)
+		assert.Equal([]string{"/status/"}, remains)
+
+		remains = nil
+		assert.Nil(tr.Match("/db").Node)
+		assert.Equal([]string{""}, remains)
+		assert.Nil(tr.Match("/other/tables/x").Node)
+		assert.Equal(1, len(remains))
+
+		tr.Define("/db").Handle("GET", "db")
+		assert.Equal("db", tr.Match("/db").Handler("GET"))
+		assert.Equal(1, len(remains))
+
+		tr = New()
+		tr.Define("/static")
+		tr.Define("/").Delegate(func(remaining string) *Matched {
+			return &Matched{Node: table, Pattern: remaining}
+		})
+		assert.Equal("/", tr.Match("/").Pattern)
+		assert.Equal("/static", tr.Match("/static").Pattern)
+		assert.Equal("", tr.Match("/static/x").Pattern)
+
+		tr = New()
+		tr.Define("/static")
+		tr.root.Delegate(func(remaining string) *Matched {
+			return &Matched{Node: table, Pattern: remaining}
+		})
+		assert.Equal("/static/x", tr.Match("/static/x").Pattern)
+	})
+
+
+	t.Run("Node.ID method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		a := tr.Define("/a")
+		b := tr.Define("/a/b/:id")
+		assert.Equal(1, a.ID())
+		assert.Equal(2, b.ID())
+		assert.Equal(0, b.parent.ID())
+		assert.Equal(1, tr.Define("/a").ID())
+		assert.Equal(2, tr.Define("/A/b/:id").ID())
+
+		// an intermediate node gets an ID when it becomes an endpoint
+		assert.Equal(3, tr.Define("/a/b").ID())
+		assert.Equal(3, tr.Match("/a/b").Node.ID())
+		assert.Equal(2, tr.Match("/a/b/1").Node.ID())
+
+		other := New()
+		other.Define("/x")
+		other.Define("/a")
+		assert.Nil(tr.Merge(other, nil))
+		assert.Equal(4, tr.Match("/x").Node.ID())
+		assert.Equal(1, tr.Match("/a").Node.ID())
+	})
+
+	t.Run("Node.Exact method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		hook := tr.Define("/hook")
+		hook.Exact()
+		tr.Define("/other")
+		index := tr.Define("/index/")
+		index.Exact()
+
+		EqualPtr(t, hook, tr.Match("/hook").Node)
+		res := tr.Match("/hook/")
+		assert.Nil(res.Node)
+		assert.Equal("", res.TSR)
+		assert.Equal("", res.FPR)
+		res = tr.Match("//hook")
+		assert.Nil(res.Node)
+		assert.Equal("", res.FPR)
+		res = tr.Match("//hook/")
+		assert.Nil(res.Node)
+		assert.Equal("", res.FPR)
+
+		EqualPtr(t, index, tr.Match("/index/").Node)
+		res = tr.Match("/index")
+		assert.Nil(res.Node)
+		assert.Equal("", res.TSR)
+
+		assert.Equal("/other", tr.Match("/other/").TSR)
+		assert.Equal("/other", tr.Match("//other").FPR)
+
+		tr = New()
+		tr.Define("/hook").Exact()
+		tr.Define("/x/:id")
+		assert.Equal("", tr.Match("/hook/").TSR)
+		assert.Equal("/x/1", tr.Match("/x/1/").TSR)
+	})
+
+	t.Run("Node.HandleSubtree method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		admin := tr.Define("/admin")
+		admin.HandleSubtree("GET", "admin get")
+		admin.HandleSubtree("*", "admin any")
+		tr.Route("GET", "/admin/users/:id", "user get")
+		tr.Route("PUT", "/admin/users/:id", "user put")
+		tr.Define("/admin/users").HandleSubtree("DELETE", "users delete")
+		tr.Define("/admin/teams")
+
+		res := tr.Match("/admin/teams")
+		assert.Equal("admin get", res.Handler("GET"))
+		assert.Equal("admin get", res.Handler("HEAD"))
+		assert.Equal("admin any", res.Handler("POST"))
+		assert.Nil(res.Node.GetHandler("GET"))
+
+		res = tr.Match("/admin/users/1")
+		assert.Equal("user get", res.Handler("GET"))
+		assert.Equal("user put", res.Handler("PUT"))
+		assert.Equal("users delete", res.Handler("DELETE"))
+		assert.Equal("admin any", res.Handler("POST"))
+
+		assert.Equal("admin get", tr.Match("/admin").Handler("GET"))
+		assert.Nil(tr.Match("/admin/users/1/").Handler("GET"))
+
+		tr.Route("GET", "/other", "other")
+		assert.Nil(tr.Match("/other").Handler("POST"))
+
+		assert.Panics(func() {
+			admin.HandleSubtree("GET", "again")
+		})
+	})
+
+	t.Run("Trie.Len and Node.Remove methods", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		assert.Equal(0, tr.Len())
+		a := tr.Define("/a")
+		assert.Equal(0, tr.Len())
+
+		a.Handle("GET", "get a")
+		assert.Equal(1, tr.Len())
+		a.Handle("PUT", "put a")
+		a.Handle("POST", "post a")
+		assert.Equal(1, tr.Len())
+		tr.Route("GET", "/a/:b", "get b")
+		assert.Equal(2, tr.Len())
+
+		assert.True(a.Remove("PUT"))
+		assert.False(a.Remove("PUT"))
+		assert.Nil(a.GetHandler("PUT"))
+		assert.Equal("GET, POST", a.GetAllow())
+		assert.Equal(2, tr.Len())
+
+		var methods []string
+		a.EachHandler(func(method string, handler interface{}) {
+			methods = append(methods, method)
+		})
+		assert.Equal([]string{"GET", "POST"}, methods)
+
+		assert.True(a.Remove("GET"))
+		assert.True(a.Remove("POST"))
+		assert.Equal(1, tr.Len())
+		assert.Equal("", a.GetAllow())
+
+		a.Handle("PUT", "put a again")
+		assert.Equal(2, tr.Len())
+		assert.Equal("PUT", a.GetAllow())
+
+		tr = New(Options{IgnoreMethodCase: true})
+		tr.Route("get", "/a", "get a")
+		assert.True(tr.Define("/a").Remove("Get"))
+		assert.Equal(0, tr.Len())
+	})
+
+	t.Run("Trie.Use and Node.Middleware methods", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		users := tr.Define("/admin/users/:id")
+		assert.Nil(users.Middleware())
+
+		tr.Use("logger", "recovery")
+		tr.Define("/admin").Use("auth")
+		users.Use("audit")
+		tr.Define("/admin/users").Use("users")
+
+		assert.Equal([]interface{}{"logger", "recovery", "auth", "users", "audit"}, users.Middleware())
+		assert.Equal([]interface{}{"logger", "recovery", "auth"}, tr.Define("/admin").Middleware())
+		assert.Equal([]interface{}{"logger", "recovery"}, tr.Define("/other").Middleware())
+		assert.Equal([]interface{}{"logger", "recovery", "auth", "users", "audit"}, tr.Match("/admin/users/1").Node.Middleware())
+
+		chain := users.Middleware()
+		chain[0] = "changed"
+		assert.Equal("logger", users.Middleware()[0])
+		tr.Use("metrics")
+		assert.Equal([]interface{}{"logger", "recovery", "metrics", "auth", "users", "audit"}, users.Middleware())
+	})
+
+	t.Run("Node.SetEnabled method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		v2 := tr.Define("/search/v2")
+		name := tr.Define("/search/:version")
+		nested := tr.Define("/search/v2/items")
+		enabled := true
+		v2.SetEnabled(func() bool {
+			return enabled
+		})
+
+		EqualPtr(t, v2, tr.Match("/search/v2").Node)
+		EqualPtr(t, nested, tr.Match("/search/v2/items").Node)
+		assert.Equal(2, len(tr.MatchAll("/search/v2")))
+
+		enabled = false
+		res := tr.Match("/search/v2")
+		EqualPtr(t, name, res.Node)
+		assert.Equal("v2", res.Params["version"])
+		assert.Nil(tr.Match("/search/v2/items").Node)
+		assert.Equal(1, len(tr.MatchAll("/search/v2")))
+
+		name.SetEnabled(func() bool {
+			return enabled
+		})
+		assert.Nil(tr.Match("/search/v2").Node)
+		assert.Nil(tr.Match("/search/v3").Node)
+
+		enabled = true
+		EqualPtr(t, v2, tr.Match("/search/v2").Node)
+		EqualPtr(t, name, tr.Match("/search/v3").Node)
+
+		tr = New()
+		static := tr.Define("/static")
+		static.SetEnabled(func() bool {
+			return enabled
+		})
+		EqualPtr(t, static, tr.Match("/static").Node)
+		enabled = false
+		assert.Nil(tr.Match("/static").Node)
+	})
+
+	t.Run("Node.GetHandlers method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/users/:id")
+		node.Handle("GET+json", "json")
+		node.Handle("GET+xml", "xml")
+		node.Handle("POST", "post")
+
+		assert.Equal("json", node.GetHandler("GET+json"))
+		assert.Equal("xml", tr.Match("/users/1").Handler("GET+xml"))
+		assert.Nil(node.GetHandler("GET"))
+		assert.Equal("GET, POST", node.GetAllow())
+
+		assert.Equal(map[string]interface{}{"GET+json": "json", "GET+xml": "xml"}, node.GetHandlers("GET"))
+		assert.Equal(map[string]interface{}{"GET+xml": "xml"}, node.GetHandlers("GET+x"))
+		assert.Equal(3, len(node.GetHandlers("")))
+		assert.Equal(0, len(node.GetHandlers("PUT")))
+
+		node.Handle("GET", "get")
+		assert.Equal(3, len(node.GetHandlers("GET")))
+		assert.Equal(2, len(node.GetHandlers("GET+")))
+
+		tr = New(Options{IgnoreMethodCase: true})
+		node = tr.Define("/users/:id")
+		node.Handle("get+json", "json")
+		assert.Equal(map[string]interface{}{"GET+JSON": "json"}, node.GetHandlers("Get"))
+	})
+
+	t.Run("Node.Transform", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{AnonymousParams: true})
+		node := tr.Define("/users/:name")
+		node.Transform(strings.ToUpper)
+		res := tr.Match("/users/john")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("JOHN", res.Params["name"])
+		assert.Equal([]Param{{"name", "JOHN"}}, res.OrderedParams())
+
+		node.Transform(func(value string) string { return value + "!" })
+		assert.Equal("JOHN!", tr.Match("/users/john").Params["name"])
+
+		node.Validate(func(value string) bool { return value == strings.ToLower(value) })
+		assert.Nil(tr.Match("/users/John").Node)
+		assert.Equal("JOHN!", tr.Match("/users/john").Params["name"])
+
+		anon := tr.Define("/files/:")
+		anon.Transform(strings.ToUpper)
+		assert.Equal([]string{"A.TXT"}, tr.Match("/files/a.txt").Positional)
+
+		res = tr.MatchBytes([]byte("/users/john"))
+		assert.Equal("JOHN!", res.Params["name"])
+	})
+
+	t.Run("Node.Fallback", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		known := tr.Define("/known")
+		name := tr.Define("/:name")
+		name.Fallback()
+		id := tr.Define("/:id(^[0-9]+$)")
+		id.Priority(-1)
+		ext := tr.Define("/:file+.json")
+
+		EqualPtr(t, known, tr.Match("/known").Node)
+		EqualPtr(t, id, tr.Match("/123").Node)
+		EqualPtr(t, ext, tr.Match("/a.json").Node)
+		res := tr.Match("/anything")
+		EqualPtr(t, name, res.Node)
+		assert.Equal("anything", res.Params["name"])
+		assert.Nil(tr.Match("/anything/else").Node)
+
+		tr = New()
+		name = tr.Define("/:name")
+		name.Fallback()
+		all := tr.Define("/:path*")
+		EqualPtr(t, all, tr.Match("/anything").Node)
+
+		other := New()
+		other.Define("/:name").Fallback()
+		other.Define("/:id(^[0-9]+$)").Priority(1)
+		tr = New()
+		assert.Nil(tr.Merge(other, nil))
+		assert.Equal("/:id(^[0-9]+$)", tr.Match("/1").Pattern)
+		assert.Equal("/:name", tr.Match("/x").Pattern)
+
+		data, err := other.Snapshot()
+		assert.Nil(err)
+		tr, err = LoadSnapshot(data, nil)
+		assert.Nil(err)
+		assert.Equal("/:id(^[0-9]+$)", tr.Match("/1").Pattern)
+		assert.Equal("/:name", tr.Match("/x").Pattern)
+	})
+
+	t.Run("Node.DefinedAt", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		_, file, line, _ := runtime.Caller(0)
+		node := tr.Define("/a/:id")
+		nodeFile, nodeLine := node.DefinedAt()
+		assert.Equal(file, nodeFile)
+		assert.Equal(line+1, nodeLine)
+		nodeFile, nodeLine = node.parent.DefinedAt()
+		assert.Equal(file, nodeFile)
+		assert.Equal(line+1, nodeLine)
+
+		tr.Define("/a/:id/b")
+		_, nodeLine = node.DefinedAt()
+		assert.Equal(line+1, nodeLine)
+
+		err := panicError(func() { tr.Define("/a/:name") })
+		assert.Equal(`invalid pattern name "name", as prev defined "/a/:id" defined at trie_test.go:`+strconv.Itoa(line+1), err.Error())
+		assert.True(errors.Is(err, ErrPatternConflict))
+
+		_, _, line, _ = runtime.Caller(0)
+		route := tr.Route("GET", "/r", "r")
+		_, nodeLine = route.DefinedAt()
+		assert.Equal(line+1, nodeLine)
+
+		assert.Nil(tr.LoadFrom(strings.NewReader("GET /loaded"), func(method, pattern string) interface{} {
+			return method
+		}))
+		nodeFile, nodeLine = tr.Match("/loaded").Node.DefinedAt()
+		assert.Equal("", nodeFile)
+		assert.Equal(0, nodeLine)
+	})
+
+	t.Run("Node.Define", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		users := tr.Define("/users")
+		posts := users.Define("/:id/posts")
+		EqualPtr(t, posts, tr.Define("/users/:id/posts"))
+		assert.Equal("/users/:id/posts", posts.GetPattern())
+		EqualPtr(t, users, posts.parent.parent)
+
+		res := tr.Match("/users/1/posts")
+		EqualPtr(t, posts, res.Node)
+		assert.Equal("1", res.Params["id"])
+		assert.Equal("/users/:id/posts", res.Pattern)
+
+		EqualPtr(t, posts, users.Define(":id/posts"))
+		EqualPtr(t, tr.Define("/users/"), users.Define("/"))
+		EqualPtr(t, tr.Define("/a"), tr.root.Define("/a"))
+
+		err := panicError(func() { users.Define("/a//b") })
+		assert.True(errors.Is(err, ErrMultiSlash))
+		files := tr.Define("/files/:path*")
+		err = panicError(func() { files.Define("/x") })
+		assert.True(errors.Is(err, ErrWildcardContinuation))
+		err = panicError(func() { users.Define("/:name/posts") })
+		assert.True(errors.Is(err, ErrPatternConflict))
+	})
+
+	t.Run("Node.SetNotFound", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.SetNotFound("404")
+		api := tr.Define("/api")
+		api.SetNotFound("api 404")
+		tr.Define("/api/users/:id").Handle("GET", "user")
+		tr.Define("/web").SetNotFound("web 404")
+		tr.Define("/web/index").Handle("GET", "index")
+
+		h, res := tr.Lookup("GET", "/api/missing")
+		assert.Equal("api 404", h)
+		assert.Nil(res.Node)
+		EqualPtr(t, api, res.LastNode)
+		h, _ = tr.Lookup("GET", "/api/users/1/missing")
+		assert.Equal("api 404", h)
+		h, _ = tr.Lookup("GET", "/web/missing")
+		assert.Equal("web 404", h)
+		h, _ = tr.Lookup("GET", "/missing")
+		assert.Equal("404", h)
+		h, _ = tr.Lookup("GET", "/api/users/1")
+		assert.Equal("user", h)
+
+		// redirects are not resolved to not found handlers
+		h, res = tr.Lookup("GET", "/web/index/")
+		assert.Nil(h)
+		assert.Equal("/web/index", res.TSR)
+
+		other := New()
+		other.Define("/docs").SetNotFound("docs 404")
+		assert.Nil(tr.Merge(other, nil))
+		h, _ = tr.Lookup("GET", "/docs/missing")
+		assert.Equal("docs 404", h)
+	})
+
+	t.Run("Node.GetMethods and Node.GetVariants", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/a")
+		node.Handle("GET+json", "json")
+		node.Handle("GET+xml", "xml")
+		assert.Equal("GET", node.GetAllow())
+		assert.Equal([]string{"GET"}, node.GetMethods())
+		assert.Equal([]string{"json", "xml"}, node.GetVariants("GET"))
+
+		node.Handle("POST", "post")
+		node.Handle("GET", "get")
+		assert.Equal("GET, POST", node.GetAllow())
+		assert.Equal([]string{"GET", "POST"}, node.GetMethods())
+		assert.Equal([]string{"json", "xml"}, node.GetVariants("GET"))
+		assert.Nil(node.GetVariants("POST"))
+		assert.Equal("json", node.GetHandler("GET+json"))
+
+		node.Remove("GET+json")
+		node.Remove("GET+xml")
+		assert.Equal("POST, GET", node.GetAllow())
+		node.Remove("GET")
+		assert.Equal("POST", node.GetAllow())
+		assert.Nil(node.GetVariants("GET"))
+
+		tr = New(Options{VariantSeparator: ";", IgnoreMethodCase: true})
+		node = tr.Define("/b")
+		node.Handle("get;json", "json")
+		node.Handle("get+xml", "xml")
+		assert.Equal("GET, GET+XML", node.GetAllow())
+		assert.Equal([]string{"JSON"}, node.GetVariants("get"))
+		assert.Equal([]string{}, New().Define("/c").GetMethods())
+	})
+
+	t.Run("Node.OnMatch", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/users/:id")
+		var calls []string
+		node.OnMatch(func(params map[string]string) {
+			calls = append(calls, "first "+params["id"])
+		})
+		node.OnMatch(func(params map[string]string) {
+			calls = append(calls, "second "+params["id"])
+		})
+		tr.Define("/users/:id/posts")
+		tr.Define("/static").OnMatch(func(params map[string]string) {
+			assert.Nil(params)
+			calls = append(calls, "static")
+		})
+
+		tr.Match("/users/42")
+		assert.Equal([]string{"first 42", "second 42"}, calls)
+
+		// not called for a descendant, a redirect or a miss
+		calls = nil
+		tr.Match("/users/42/posts")
+		tr.Match("/users/42/")
+		tr.Match("/users//42")
+		tr.Match("/none")
+		assert.Nil(calls)
+
+		tr.Match("/static")
+		assert.Equal([]string{"static"}, calls)
+
+		// MatchQuery calls the hooks only if the query constraints are satisfied
+		calls = nil
+		tr.OnMiss(func(path string, depth int) {
+			calls = append(calls, "miss "+path)
+		})
+		search := tr.Define("/search")
+		search.RequireQuery("type", "^image$")
+		search.OnMatch(func(params map[string]string) {
+			calls = append(calls, "search")
+		})
+		assert.Nil(tr.MatchQuery("/search", url.Values{"type": {"video"}}).Node)
+		assert.Equal([]string{"miss /search"}, calls)
+		assert.NotNil(tr.MatchQuery("/search", url.Values{"type": {"image"}}).Node)
+		assert.Equal([]string{"miss /search", "search"}, calls)
+
+		tr.Freeze()
+		assert.Panics(func() {
+			node.OnMatch(func(map[string]string) {})
+		})
+	})
+
+	t.Run("Node.ReplaceHandlers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/users/:id")
+		node.Handle("GET", "v1")
+		node.Handle("PUT", "v1")
+		node.ReplaceHandlers(map[string]interface{}{"POST": "v2", "GET": "v2"})
+		assert.Equal("v2", node.GetHandler("GET"))
+		assert.Equal("v2", node.GetHandler("POST"))
+		assert.Nil(node.GetHandler("PUT"))
+		assert.Equal("GET, POST", node.GetAllow())
+		assert.Equal(1, tr.Len())
+
+		node.ReplaceHandlers(nil)
+		assert.False(node.HasHandlers())
+		assert.Equal("", node.GetAllow())
+		assert.Equal(0, tr.Len())
+
+		// concurrent matches see either the old handlers or the new ones
+		node.ReplaceHandlers(map[string]interface{}{"GET": "v0", "POST": "v0"})
+		tr.Freeze()
+		done := make(chan struct{})
+		errs := make(chan string, 1)
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				handlers := tr.Match("/users/42").Node.GetHandlers("")
+				if len(handlers) != 2 || handlers["GET"] != handlers["POST"] {
+					errs <- "mixed handlers: " + handlers["GET"].(string) + ", " + handlers["POST"].(string)
+					return
+				}
+			}
+		}()
+		for i := 1; i <= 1000; i++ {
+			version := "v" + strconv.Itoa(i)
+			node.ReplaceHandlers(map[string]interface{}{"GET": version, "POST": version})
+		}
+		<-done
+		select {
+		case err := <-errs:
+			t.Error(err)
+		default:
+		}
+
+		// Len can be read while handlers are mounted and removed
+		tr = New()
+		node = tr.Define("/a")
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				if l := tr.Len(); l < 0 || l > 1 {
+					t.Errorf("Len: %d", l)
+					return
+				}
+			}
+		}()
+		for i := 0; i < 1000; i++ {
+			node.ReplaceHandlers(map[string]interface{}{"GET": i})
+			node.ReplaceHandlers(nil)
+		}
+		<-done
+		assert.Equal(0, tr.Len())
+
+		// concurrent replacements count the node once
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					node.ReplaceHandlers(map[string]interface{}{"GET": i})
+					node.ReplaceHandlers(nil)
+				}
+			}(i)
+		}
+		wg.Wait()
+		assert.Equal(0, tr.Len())
+		node.ReplaceHandlers(map[string]interface{}{"GET": "a"})
+		assert.Equal(1, tr.Len())
+
+		// nil handlers are dropped
+		node.ReplaceHandlers(map[string]interface{}{"GET": nil, "POST": "b"})
+		assert.Equal("POST", node.GetAllow())
+		node.ReplaceHandlers(map[string]interface{}{"GET": nil})
+		assert.False(node.HasHandlers())
+		assert.Equal(0, tr.Len())
+
+		// only an endpoint can be handled
+		tr.Define("/x/y")
+		assert.PanicsWithError(`"/x" is not an endpoint`, func() {
+			tr.Define("/x/y").parent.ReplaceHandlers(map[string]interface{}{"GET": "x"})
+		})
+		assert.Equal(0, tr.Len())
+	})
+
+	t.Run("Node.Constrain", func(t *testing.T) {
+		assert := assert.New(t)
+
+		ordered := func(params map[string]string) bool {
+			from, _ := strconv.Atoi(params["from"])
+			to, _ := strconv.Atoi(params["to"])
+			return from <= to
+		}
+
+		tr := New()
+		node := tr.Define("/range/:from/:to")
+		node.Constrain(ordered)
+		res := tr.Match("/range/2/5")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("5", res.Params["to"])
+
+		res = tr.Match("/range/5/2")
+		assert.Nil(res.Node)
+		assert.Equal("", res.TSR)
+		assert.Nil(tr.Match("/range/5/2/").Node)
+		assert.Nil(tr.Match("/range//5/2").Node)
+		assert.Equal("", tr.Match("/range//5/2").FPR)
+		assert.Equal("/range/2/5", tr.Match("/range//2/5").FPR)
+
+		// all the constraints must be satisfied
+		node.Constrain(func(params map[string]string) bool {
+			return params["from"] != "0"
+		})
+		assert.Nil(tr.Match("/range/0/5").Node)
+		EqualPtr(t, node, tr.Match("/range/1/5").Node)
+
+		// MatchSegments applies the constraints like Match
+		EqualPtr(t, node, tr.MatchSegments([]string{"range", "2", "5"}).Node)
+		res = tr.MatchSegments([]string{"range", "5", "2"})
+		assert.Nil(res.Node)
+		assert.Equal("", res.Pattern)
+		assert.Nil(tr.MatchSegments([]string{"range", "0", "5"}).Node)
+
+		// the other candidates are tried by MatchAll and MatchLongest
+		other := tr.Define("/range/:lo(^[0-9]+$)/:hi")
+		results := tr.MatchAll("/range/5/2")
+		assert.Equal(1, len(results))
+		EqualPtr(t, other, results[0].Node)
+
+		tr = New()
+		tr.Define("/range/:from/:to").Constrain(ordered)
+		tr.Define("/range/:from").Constrain(func(params map[string]string) bool {
+			return params["from"] != "9"
+		})
+		res = tr.MatchLongest("/range/5/2")
+		assert.Equal("/range/:from", res.Pattern)
+		assert.Equal("/2", res.Tail)
+		assert.Nil(tr.MatchLongest("/range/9/2").Node)
+
+		tr.Freeze()
+		assert.Panics(func() {
+			tr.Match("/range/2/5").Node.Constrain(ordered)
+		})
+	})
+
+	t.Run("Node.ChildKeys and Node.HasVaryChild", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/api/users")
+		tr.Define("/api/Teams")
+		tr.Define("/api/\\(x\\)")
+		tr.Define("/api/:id(^[0-9]+$)")
+		tr.Define("/api/:name")
+		tr.Define("/files/:path*")
+		tr.Define("/leaf")
+
+		api := tr.Match("/api").LastNode
+		assert.Equal([]string{"(x)", "teams", "users"}, api.ChildKeys())
+		name, wildcard, ok := api.HasVaryChild()
+		assert.Equal("id", name)
+		assert.False(wildcard)
+		assert.True(ok)
+
+		files := tr.Match("/files").LastNode
+		assert.Equal([]string{}, files.ChildKeys())
+		name, wildcard, ok = files.HasVaryChild()
+		assert.Equal("path", name)
+		assert.True(wildcard)
+		assert.True(ok)
+
+		_, _, ok = tr.Match("/leaf").Node.HasVaryChild()
+		assert.False(ok)
+		assert.Equal([]string{"api", "files", "leaf"}, tr.root.ChildKeys())
+	})
+}
+
+func TestGearTrieWalk(t *testing.T) {
+	t.Run("WalkFunc", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/admin/users")
+		tr.Define("/admin/roles/:id")
+		tr.Define("/api/users/:id")
+		tr.Define("/api/files/:path*")
+
+		var patterns []string
+		tr.WalkFunc(func(pattern string, n *Node) bool {
+			patterns = append(patterns, pattern)
+			return true
+		})
+		assert.Equal([]string{
+			"/admin", "/admin/roles", "/admin/roles/:id", "/admin/users",
+			"/api", "/api/files", "/api/files/:path*", "/api/users", "/api/users/:id",
+		}, patterns)
+
+		patterns = patterns[:0]
+		tr.WalkFunc(func(pattern string, n *Node) bool {
+			patterns = append(patterns, pattern)
+			return pattern == "/admin" || pattern == "/admin/roles"
+		})
+		assert.Equal([]string{"/admin", "/admin/roles", "/admin/roles/:id", "/admin/users", "/api"}, patterns)
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		assert.Equal(TrieStats{}, tr.Stats())
+
+		tr.Define("/")
+		tr.Define("/api/users")
+		tr.Define("/api/users/:id(^\\d+$)")
+		tr.Define("/api/users/:id(^\\d+$)/posts/:pid")
+		tr.Define("/api/files/:path*")
+		assert.Equal(TrieStats{
+			NodeCount:     8,
+			EndpointCount: 5,
+			MaxDepth:      5,
+			ParamNodes:    3,
+			WildcardNodes: 1,
+			RegexNodes:    1,
+		}, tr.Stats())
+	})
+
+	t.Run("Walk", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/:id([0-9]+)")
+		tr.Define("/:id([0-9]+)/::raw/:b(^x$)+:del")
+		tr.Define("/files/:path*")
+		tr.Define("/files/")
+
+		var patterns []string
+		tr.Walk(func(pattern string, n *Node) {
+			patterns = append(patterns, pattern)
+			assert.True(n.endpoint)
+		})
+		assert.Equal([]string{
+			"/files/", "/files/:path*", "/:id([0-9]+)", "/:id([0-9]+)/::raw/:b(^x$)+:del",
+		}, patterns)
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/files/:name")
+		tr.Define("/files/:path*")
+		tr.Define("/a/:x+del")
+		tr.Define("/a/:y+:del")
+		tr.Define("/a/:y+:del/b")
+		tr.Define("/a/:z+xyz")
+		assert.Nil(tr.Match("/files/a/b").Node)
+
+		assert.Equal([]string{"/a/:y+:del", "/a/:y+:del/b", "/files/:path*"}, tr.Unreachable())
+
+		tr = New()
+		tr.Define("/files/:name+x")
+		tr.Define("/files/:path*")
+		tr.Define("/files/list")
+		assert.Nil(tr.Unreachable())
+
+		// a validated parameter falls through to the catch-all
+		tr = New()
+		tr.Define("/a/:id").Validate(func(value string) bool { return value == "x" })
+		rest := tr.Define("/a/:rest*")
+		EqualPtr(t, rest, tr.Match("/a/y").Node)
+		assert.Nil(tr.Unreachable())
+
+		// so does a disabled parameter
+		tr = New()
+		tr.Define("/b/:id").SetEnabled(func() bool { return false })
+		rest = tr.Define("/b/:rest*")
+		EqualPtr(t, rest, tr.Match("/b/1").Node)
+		assert.Nil(tr.Unreachable())
+	})
+
+	t.Run("Orphans method", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		assert.Nil(tr.Orphans())
+
+		tr.Route("GET", "/a", "a")
+		tr.Route("GET", "/a/b/c", "c")
+		b := tr.Define("/a/b")
+		tr.Define("/x/:id")
+		assert.False(b.HasHandlers())
+		assert.True(tr.Define("/a").HasHandlers())
+		assert.False(tr.Define("/a/b/c").parent.parent.parent.HasHandlers())
+		assert.Equal([]string{"/a/b", "/x/:id"}, tr.Orphans())
+
+		b.Handle("GET", "b")
+		assert.True(b.HasHandlers())
+		assert.Equal([]string{"/x/:id"}, tr.Orphans())
+
+		b.Remove("GET")
+		assert.Equal([]string{"/a/b", "/x/:id"}, tr.Orphans())
+	})
+
+	t.Run("Trie.Fingerprint", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr1 := New()
+		tr1.Define("/a").Handle("GET", "a")
+		tr1.Define("/a").Handle("POST", "a")
+		tr1.Define("/users/:id([0-9]+)").Handle("GET", "user")
+		tr1.Define("/files/:path*")
+
+		tr2 := New()
+		tr2.Define("/files/:path*")
+		tr2.Define("/users/:id([0-9]+)").Handle("GET", "user")
+		tr2.Define("/a").Handle("POST", "a")
+		tr2.Define("/a").Handle("GET", "a")
+
+		fingerprint := tr1.Fingerprint()
+		assert.Equal(64, len(fingerprint))
+		assert.Equal(fingerprint, tr2.Fingerprint())
+		assert.Equal(fingerprint, tr1.Fingerprint())
+
+		tr2.Define("/a").Handle("PUT", "a")
+		assert.NotEqual(fingerprint, tr2.Fingerprint())
+		tr2.Define("/a").Remove("PUT")
+		assert.Equal(fingerprint, tr2.Fingerprint())
+		tr2.Define("/b")
+		assert.NotEqual(fingerprint, tr2.Fingerprint())
+
+		assert.NotEqual(New().Fingerprint(), fingerprint)
+		assert.Equal(New().Fingerprint(), New().Fingerprint())
+	})
+
+	t.Run("Endpoints", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		assert.Nil(tr.Endpoints())
+
+		tr.Define("/users/:id").Handle("GET", "getUser")
+		tr.Define("/users/:id").Handle("DELETE", "deleteUser")
+		tr.Define("/a").Handle("POST", "postA")
+		tr.Define("/a").Handle("GET+json", "getAJSON")
+		tr.Define("/orphan")
+
+		assert.Equal([]Endpoint{
+			{"/a", "GET+json", "getAJSON"},
+			{"/a", "POST", "postA"},
+			{"/users/:id", "DELETE", "deleteUser"},
+			{"/users/:id", "GET", "getUser"},
+		}, tr.Endpoints())
+
+		var endpoints []Endpoint
+		for _, e := range tr.Endpoints() {
+			if e.Pattern == "/users/:id" {
+				endpoints = append(endpoints, e)
+			}
+		}
+		assert.Equal(2, len(endpoints))
+	})
+
+	t.Run("original casing with IgnoreCase", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{IgnoreCase: true})
+		node := tr.Define("/Users/:ID")
+		tr.Define("/users/:ID/Posts")
+
+		var patterns []string
+		tr.Walk(func(pattern string, _ *Node) {
+			patterns = append(patterns, pattern)
+		})
+		assert.Equal([]string{"/Users/:ID", "/Users/:ID/Posts"}, patterns)
+
+		res := tr.Match("/users/5")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("5", res.Params["ID"])
+		assert.Equal("/Users/:ID", res.Pattern)
+		EqualPtr(t, node, tr.Match("/USERS/5").Node)
+
+		path, err := node.BuildPath(map[string]string{"ID": "5"})
+		assert.Nil(err)
+		assert.Equal("/Users/5", path)
+
+		assert.Equal("users", node.parent.key)
+		assert.Equal("Users", node.parent.segment)
+		assert.Equal(1, tr.RemoveSubtree("/USERS/:ID/posts"))
+		assert.Nil(tr.Match("/users/5/posts").Node)
+	})
+
+	t.Run("Alias", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		node := tr.Define("/users/:id")
+		assert.Nil(tr.Alias("/users/:id", "/u/:id"))
+		node.Handle("GET", "getUser")
+
+		res := tr.Match("/u/42")
+		EqualPtr(t, node, res.Node)
+		assert.Equal("/users/:id", res.Pattern)
+		assert.Equal("42", res.Params["id"])
+		assert.Equal("getUser", res.Node.GetHandler("GET"))
+		EqualPtr(t, node, tr.MatchLongest("/u/42/x").Node)
+		EqualPtr(t, node, tr.MatchAll("/u/42")[0].Node)
+		res = tr.MatchSegments([]string{"u", "42"})
+		EqualPtr(t, node, res.Node)
+		assert.Equal("/users/:id", res.Pattern)
+		assert.Equal("42", res.Params["id"])
+
+		var patterns []string
+		tr.Walk(func(pattern string, _ *Node) {
+			patterns = append(patterns, pattern)
+		})
+		assert.Equal([]string{"/u/:id", "/users/:id"}, patterns)
+
+		// reports count the handlers of the resolved node
+		assert.Nil(tr.Orphans())
+		assert.Equal([]Endpoint{{"/u/:id", "GET", "getUser"}, {"/users/:id", "GET", "getUser"}}, tr.Endpoints())
+		other := New()
+		other.Define("/users/:id").Handle("GET", "getUser")
+		other.Define("/u/:id").Handle("GET", "getUser")
+		assert.Equal(other.Fingerprint(), tr.Fingerprint())
+
+		// snapshots leave out the alias
+		data, err := tr.Snapshot()
+		assert.Nil(err)
+		restored, err := LoadSnapshot(data, func(pattern, method string) interface{} { return "getUser" })
+		assert.Nil(err)
+		assert.False(restored.Has("/u/:id"))
+		assert.Nil(restored.Match("/u/42").Node)
+		assert.Nil(restored.Orphans())
+
+		// an alias of an alias resolves to the existing node
+		assert.Nil(tr.Alias("/u/:id", "/people/:id"))
+		EqualPtr(t, node, tr.Match("/people/7").Node)
+
+		err = tr.Alias("/none", "/n")
+		assert.True(errors.Is(err, ErrNotDefined))
+		err = tr.Alias("/users/:id", "/v/:uid")
+		assert.True(errors.Is(err, ErrPatternConflict))
+		assert.False(tr.Has("/v/:uid"))
+		err = tr.Alias("/users/:id", "/u/:id")
+		assert.True(errors.Is(err, ErrPatternConflict))
+		tr.Define("/w/:id").Handle("GET", "other")
+		err = tr.Alias("/users/:id", "/w/:id")
+		assert.True(errors.Is(err, ErrPatternConflict))
+
+		tr.Freeze()
+		assert.Panics(func() {
+			tr.Alias("/users/:id", "/x/:id")
+		})
+	})
+
+	t.Run("Alias of removed node", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New()
+		tr.Define("/users/:id").Handle("GET", "getUser")
+		tr.Define("/short/keep")
+		assert.Nil(tr.Alias("/users/:id", "/short/u/:id"))
+
+		// the alias is dropped with its target and counted as removed
+		assert.Equal(2, tr.RemoveSubtree("/users"))
+		assert.Nil(tr.Match("/short/u/42").Node)
+		assert.Nil(tr.MatchSegments([]string{"short", "u", "42"}).Node)
+		assert.False(tr.Has("/short/u/:id"))
+
+		// the nodes of the dropped alias are removed by Compact
+		assert.Equal(2, tr.Compact())
+		assert.NotNil(tr.Match("/short/keep").Node)
+		var patterns []string
+		tr.Walk(func(pattern string, _ *Node) {
+			patterns = append(patterns, pattern)
+		})
+		assert.Equal([]string{"/short/keep"}, patterns)
+
+		// the alias can be defined again for a new node
+		node := tr.Define("/users/:id")
+		assert.Nil(tr.Alias("/users/:id", "/short/u/:id"))
+		EqualPtr(t, node, tr.Match("/short/u/1").Node)
+	})
+
+	t.Run("Unreachable with StrictEmptyParams", func(t *testing.T) {
+		assert := assert.New(t)
+
+		tr := New(Options{FixedPathRedirect: true, StrictEmptyParams: true})
+		tr.Define("/files/:name")
+		path := tr.Define("/files/:path*")
+		EqualPtr(t, path, tr.Match("/files/").Node)
+		tr.Define("/docs/:name")
+		tr.Define("/docs/:rest+")
+
+		// ":path*" matches an empty segment, ":rest+" never matches first
+		assert.Equal([]string{"/docs/:rest+"}, tr.Unreachable())
 	})
 }